@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	connectionsKey = "connections:%s"
+
+	// How often a node reports its connection count, the report expires after three periods
+	connectionsReportPeriod = 30 * time.Second
+)
+
+// DisconnectUser closes the connections of the user on every node.
+func (server *WsServer) DisconnectUser(userID string) error {
+	message := &Message{
+		Action:  DisconnectUserAction,
+		Message: userID,
+	}
+
+	return server.redis.Publish(ctx, PubSubGeneralChannel, message.encode()).Err()
+}
+
+// DeleteRoom evicts the clients of the room and stops it on every node, then removes it
+// and its attachments. The rows are purged last so that no message still in flight is
+// stored into the deleted room.
+func (server *WsServer) DeleteRoom(roomID string) error {
+	message := &Message{
+		Action:  RoomDeletedAction,
+		Message: roomID,
+	}
+
+	if err := server.redis.Publish(ctx, PubSubGeneralChannel, message.encode()).Err(); err != nil {
+		return err
+	}
+
+	// The local room is stopped right away, once it took the removal it handles no more posts.
+	if room := server.findLocalRoomByID(roomID); room != nil {
+		room.remove()
+	}
+
+	if err := server.roomRepository.DeleteRoom(roomID); err != nil {
+		return err
+	}
+
+	if ids, err := server.attachmentRepository.DeleteRoomAttachments(roomID); err != nil {
+		log.Println(err)
+	} else {
+		server.deleteAttachmentBlobs(ids)
+	}
+
+	if err := server.redis.Del(ctx, fmt.Sprintf(roomSeqKey, roomID)).Err(); err != nil {
+		log.Println(err)
+	}
+
+	return nil
+}
+
+// ArchiveRoom makes the room read-only and hides it from the directory, or undoes that.
+// Members are notified on every node.
+func (server *WsServer) ArchiveRoom(roomID string, archived bool) error {
+	if err := server.roomRepository.SetRoomArchived(roomID, archived); err != nil {
+		return err
+	}
+
+	message := &Message{
+		Action:  RoomUnarchivedAction,
+		Message: roomID,
+	}
+	if archived {
+		message.Action = RoomArchivedAction
+	}
+
+	return server.redis.Publish(ctx, PubSubGeneralChannel, message.encode()).Err()
+}
+
+// ConnectionCounts returns the number of connections each live node reported.
+func (server *WsServer) ConnectionCounts() (map[string]int, error) {
+	counts := make(map[string]int)
+
+	iter := server.redis.Scan(ctx, 0, fmt.Sprintf(connectionsKey, "*"), 0).Iterator()
+	for iter.Next(ctx) {
+		value, err := server.redis.Get(ctx, iter.Val()).Result()
+		if err != nil {
+			continue
+		}
+
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+
+		var nodeID string
+		fmt.Sscanf(iter.Val(), connectionsKey, &nodeID)
+		counts[nodeID] = count
+	}
+
+	return counts, iter.Err()
+}
+
+func (server *WsServer) reportConnections() {
+	key := fmt.Sprintf(connectionsKey, server.nodeID)
+	if err := server.redis.Set(ctx, key, len(server.clients), 3*connectionsReportPeriod).Err(); err != nil {
+		log.Println(err)
+	}
+}
+
+func (server *WsServer) handleDisconnectUser(message Message) {
+	// Closing the connection makes the read pump disconnect the client.
+	for _, client := range server.findClientsByID(message.Message) {
+		client.conn.Close()
+	}
+}
+
+// handleRoomDeleted has the room evict its clients and stop, if it runs on this node.
+func (server *WsServer) handleRoomDeleted(message Message) {
+	if room := server.findLocalRoomByID(message.Message); room != nil {
+		room.remove()
+	}
+}
+
+func (server *WsServer) handleRoomArchived(message Message) {
+	room := server.findLocalRoomByID(message.Message)
+	if room == nil {
+		return
+	}
+
+	room.setArchived(message.Action == RoomArchivedAction)
+
+	event := &Message{
+		Action: message.Action,
+		Target: room,
+	}
+	room.deliver(event.encode())
+}
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/nagohak/chat-app/auth"
+	"github.com/nagohak/chat-app/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// Hub is the part of the chat server the admin API acts on. Implementations have to
+// reach the clients on every node, not only the local ones.
+type Hub interface {
+	DisconnectUser(userId string) error
+	DeleteRoom(roomId string) error
+	ArchiveRoom(roomId string, archived bool) error
+	// ConnectionCounts returns the number of open websocket connections per node.
+	ConnectionCounts() (map[string]int, error)
+}
+
+type AdminUser struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Admin    bool   `json:"admin"`
+	Disabled bool   `json:"disabled"`
+}
+
+type RoomInfo struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Private     bool   `json:"private"`
+	Topic       string `json:"topic,omitempty"`
+	Description string `json:"description,omitempty"`
+	Archived    bool   `json:"archived,omitempty"`
+}
+
+type DisableUser struct {
+	Id       string `json:"id"`
+	Disabled bool   `json:"disabled"`
+}
+
+type ArchiveRoom struct {
+	Id       string `json:"id"`
+	Archived bool   `json:"archived"`
+}
+
+type TargetId struct {
+	Id string `json:"id"`
+}
+
+type ConnectionCounts struct {
+	Total int            `json:"total"`
+	Nodes map[string]int `json:"nodes"`
+}
+
+type AdminApi struct {
+	userRepository models.UserRepository
+	roomRepository models.RoomRepository
+	hub            Hub
+	auth           auth.Auth
+}
+
+func NewAdminApi(userRepository models.UserRepository, roomRepository models.RoomRepository, hub Hub, auth auth.Auth) *AdminApi {
+	return &AdminApi{
+		userRepository: userRepository,
+		roomRepository: roomRepository,
+		hub:            hub,
+		auth:           auth,
+	}
+}
+
+// Users lists users, optionally filtered by ?query=, paginated with ?limit= and ?offset=.
+func (api *AdminApi) Users(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, offset := pagination(r)
+
+	dbUsers, err := api.userRepository.SearchUsers(r.URL.Query().Get("query"), limit, offset)
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	users := make([]AdminUser, 0, len(dbUsers))
+	for _, dbUser := range dbUsers {
+		users = append(users, AdminUser{
+			Id:       dbUser.GetID(),
+			Name:     dbUser.GetName(),
+			Username: dbUser.GetUsername(),
+			Admin:    dbUser.GetAdmin(),
+			Disabled: dbUser.GetDisabled(),
+		})
+	}
+
+	jsonResponse(w, users)
+}
+
+// DisableUser disables or re-enables an account. Disabled users are disconnected everywhere.
+func (api *AdminApi) DisableUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var user DisableUser
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := api.userRepository.SetUserDisabled(user.Id, user.Disabled); err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if user.Disabled {
+		if err := api.hub.DisconnectUser(user.Id); err != nil {
+			errorResponse(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisconnectUser closes every websocket connection of the user on every node.
+func (api *AdminApi) DisconnectUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var user TargetId
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := api.hub.DisconnectUser(user.Id); err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Rooms lists rooms, optionally filtered by ?query=, paginated with ?limit= and ?offset=.
+func (api *AdminApi) Rooms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, offset := pagination(r)
+
+	dbRooms, err := api.roomRepository.SearchRooms(r.URL.Query().Get("query"), limit, offset)
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, roomInfos(dbRooms))
+}
+
+func (api *AdminApi) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var room TargetId
+	if err := json.NewDecoder(r.Body).Decode(&room); err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := api.hub.DeleteRoom(room.Id); err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ArchiveRoom archives or unarchives a room. Archived rooms are read-only and hidden from the directory.
+func (api *AdminApi) ArchiveRoom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var room ArchiveRoom
+	if err := json.NewDecoder(r.Body).Decode(&room); err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := api.hub.ArchiveRoom(room.Id, room.Archived); err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *AdminApi) Connections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	nodes, err := api.hub.ConnectionCounts()
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	counts := ConnectionCounts{Nodes: nodes}
+	for _, count := range nodes {
+		counts.Total += count
+	}
+
+	jsonResponse(w, counts)
+}
+
+// AdminMiddleware only lets through requests with a valid token of an enabled admin user.
+func (api *AdminApi) AdminMiddleware(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dbUser, status := authenticate(r, api.auth, api.userRepository)
+		if dbUser == nil {
+			errorResponse(w, http.StatusText(status), status)
+			return
+		}
+
+		if !dbUser.GetAdmin() {
+			errorResponse(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), auth.UserContextKey, dbUser)
+		f(w, r.WithContext(ctx))
+	}
+}
+
+func roomInfos(dbRooms []models.Room) []RoomInfo {
+	rooms := make([]RoomInfo, 0, len(dbRooms))
+	for _, dbRoom := range dbRooms {
+		rooms = append(rooms, RoomInfo{
+			Id:          dbRoom.GetId(),
+			Name:        dbRoom.GetName(),
+			Private:     dbRoom.GetPrivate(),
+			Topic:       dbRoom.GetTopic(),
+			Description: dbRoom.GetDescription(),
+			Archived:    dbRoom.GetArchived(),
+		})
+	}
+
+	return rooms
+}
+
+func pagination(r *http.Request) (int, int) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	return limit, offset
+}
+
+func jsonResponse(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+func createdResponse(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nagohak/chat-app/models"
+	"github.com/nagohak/chat-app/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	roomRepo = new(mockRoomRepo)
+	hub      = new(mockHub)
+	adminApi = NewAdminApi(userRepo, roomRepo, hub, authService)
+)
+
+var admin = &repository.User{
+	Id:       "2",
+	Name:     "admin",
+	Username: "admin",
+	Password: "secret",
+	Admin:    true,
+}
+
+type mockRoomRepo struct {
+	mock.Mock
+}
+
+func (m *mockRoomRepo) AddRoom(room models.Room) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) FindRoomByName(name string) (models.Room, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(models.Room), args.Error(1)
+}
+func (m *mockRoomRepo) FindRoomById(id string) (models.Room, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(models.Room), args.Error(1)
+}
+func (m *mockRoomRepo) SearchRooms(query string, limit int, offset int) ([]models.Room, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Room), args.Error(1)
+}
+func (m *mockRoomRepo) ListPublicRooms(prefix string, limit int, offset int) ([]models.RoomSummary, error) {
+	args := m.Called(prefix)
+	return args.Get(0).([]models.RoomSummary), args.Error(1)
+}
+func (m *mockRoomRepo) UpdateRoom(id string, topic string, description string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) RenameRoom(id string, name string, renamedBy string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) SetRoomArchived(id string, archived bool) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) DeleteRoom(id string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) AddDirectRoom(roomId string, userA string, userB string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) FindDirectRoom(userA string, userB string) (models.Room, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(models.Room), args.Error(1)
+}
+func (m *mockRoomRepo) GetDirectRooms(userId string) ([]models.DirectRoom, error) {
+	args := m.Called()
+	return args.Get(0).([]models.DirectRoom), args.Error(1)
+}
+func (m *mockRoomRepo) AddRoomMember(roomId string, userId string, role string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) RemoveRoomMember(roomId string, userId string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) IsRoomMember(roomId string, userId string) (bool, error) {
+	args := m.Called()
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockRoomRepo) AddRoomMembers(roomId string, userIds []string, role string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) GetRoomMemberIds(roomId string) ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+func (m *mockRoomRepo) GetRoomRole(roomId string, userId string) (string, error) {
+	args := m.Called()
+	return args.String(0), args.Error(1)
+}
+func (m *mockRoomRepo) SetRoomRole(roomId string, userId string, role string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) GetUserRooms(userId string) ([]models.Room, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Room), args.Error(1)
+}
+func (m *mockRoomRepo) AddSanction(roomId string, userId string, kind string, createdBy string, expiresAt time.Time) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) RemoveSanction(roomId string, userId string, kind string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockRoomRepo) GetSanction(roomId string, userId string, kind string) (bool, time.Time, error) {
+	args := m.Called()
+	return args.Bool(0), args.Get(1).(time.Time), args.Error(2)
+}
+
+type mockHub struct {
+	mock.Mock
+}
+
+func (m *mockHub) DisconnectUser(userId string) error {
+	args := m.Called(userId)
+	return args.Error(0)
+}
+func (m *mockHub) DeleteRoom(roomId string) error {
+	args := m.Called(roomId)
+	return args.Error(0)
+}
+func (m *mockHub) ArchiveRoom(roomId string, archived bool) error {
+	args := m.Called(roomId, archived)
+	return args.Error(0)
+}
+func (m *mockHub) ConnectionCounts() (map[string]int, error) {
+	args := m.Called()
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
+func adminRequest(t *testing.T, method, url string, body []byte) *http.Request {
+	token, err := authService.CreateToken(admin)
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest(method, url, bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+func TestAdminForbiddenForNonAdmin(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+
+	req := adminRequest(t, "GET", "/api/admin/users", nil)
+	handler := adminApi.AdminMiddleware(adminApi.Users)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestAdminUnauthorizedWithoutToken(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/admin/users", nil)
+	handler := adminApi.AdminMiddleware(adminApi.Users)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestAdminUsers(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(admin, nil)
+	userRepo.On("SearchUsers").Once().Return([]models.DbUser{user, admin}, nil)
+
+	req := adminRequest(t, "GET", "/api/admin/users?query=te", nil)
+	handler := adminApi.AdminMiddleware(adminApi.Users)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "password")
+
+	var users []AdminUser
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &users))
+	assert.Len(t, users, 2)
+	assert.True(t, users[1].Admin)
+}
+
+func TestAdminDisableUserDisconnects(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(admin, nil)
+	userRepo.On("SetUserDisabled").Once().Return(nil)
+	hub.On("DisconnectUser", user.Id).Once().Return(nil)
+
+	data := []byte(`{"id": "` + user.Id + `", "disabled": true}`)
+	req := adminRequest(t, "POST", "/api/admin/users/disable", data)
+	handler := adminApi.AdminMiddleware(adminApi.DisableUser)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	hub.AssertCalled(t, "DisconnectUser", user.Id)
+}
+
+func TestAdminConnections(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(admin, nil)
+	hub.On("ConnectionCounts").Once().Return(map[string]int{"a": 2, "b": 3}, nil)
+
+	req := adminRequest(t, "GET", "/api/admin/connections", nil)
+	handler := adminApi.AdminMiddleware(adminApi.Connections)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var counts ConnectionCounts
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &counts))
+	assert.Equal(t, 5, counts.Total)
+}
+
+func TestAdminArchiveRoom(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(admin, nil)
+	hub.On("ArchiveRoom", "10", true).Once().Return(nil)
+
+	data := []byte(`{"id": "10", "archived": true}`)
+	req := adminRequest(t, "POST", "/api/admin/rooms/archive", data)
+	handler := adminApi.AdminMiddleware(adminApi.ArchiveRoom)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	hub.AssertCalled(t, "ArchiveRoom", "10", true)
+}
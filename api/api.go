@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/nagohak/chat-app/auth"
@@ -54,6 +55,11 @@ func (api *Api) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if dbUser.GetDisabled() {
+		errorResponse(w, "Account disabled", http.StatusForbidden)
+		return
+	}
+
 	ok, err := api.auth.ComparePassword(user.Password, dbUser.GetPassword())
 	if !ok || err != nil {
 		errorResponse(w, "Invalid password", http.StatusForbidden)
@@ -122,7 +128,7 @@ func (api *Api) AuthMiddleware(f http.HandlerFunc) http.HandlerFunc {
 
 		if tok && len(token) == 1 {
 			user, err := api.auth.ValidateToken(token[0])
-			if err != nil {
+			if err != nil || api.isDisabled(user) {
 				http.Error(w, "Forbidden", http.StatusForbidden)
 			} else {
 				ctx := context.WithValue(r.Context(), auth.UserContextKey, user)
@@ -139,6 +145,63 @@ func (api *Api) AuthMiddleware(f http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+func (api *Api) isDisabled(user models.User) bool {
+	dbUser, err := api.userRepository.FindDbUserById(user.GetID())
+	if err != nil || dbUser == nil {
+		return false
+	}
+
+	return dbUser.GetDisabled()
+}
+
+// TokenMiddleware only lets through requests with a valid token of an enabled user.
+// Unlike AuthMiddleware it does not accept anonymous users.
+func (api *Api) TokenMiddleware(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dbUser, status := authenticate(r, api.auth, api.userRepository)
+		if dbUser == nil {
+			errorResponse(w, http.StatusText(status), status)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), auth.UserContextKey, dbUser)
+		f(w, r.WithContext(ctx))
+	}
+}
+
+// authenticate returns the enabled user owning the request token, or nil and the HTTP status to reply with.
+func authenticate(r *http.Request, auth auth.Auth, userRepository models.UserRepository) (models.DbUser, int) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, http.StatusUnauthorized
+	}
+
+	user, err := auth.ValidateToken(token)
+	if err != nil || user == nil {
+		return nil, http.StatusForbidden
+	}
+
+	dbUser, err := userRepository.FindDbUserById(user.GetID())
+	if err != nil {
+		return nil, http.StatusInternalServerError
+	}
+
+	if dbUser == nil || dbUser.GetDisabled() {
+		return nil, http.StatusForbidden
+	}
+
+	return dbUser, http.StatusOK
+}
+
+// bearerToken reads the token from the Authorization header or the bearer query parameter.
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+
+	return r.URL.Query().Get("bearer")
+}
+
 func errorResponse(w http.ResponseWriter, msg string, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
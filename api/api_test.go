@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/nagohak/chat-app/auth"
@@ -59,6 +60,59 @@ func (m *mockUserRepo) FindUserByUsername(username string) (models.DbUser, error
 
 	return args.Get(0).(models.DbUser), args.Error(1)
 }
+func (m *mockUserRepo) FindDbUserById(id string) (models.DbUser, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(models.DbUser), args.Error(1)
+}
+func (m *mockUserRepo) SearchUsers(query string, limit int, offset int) ([]models.DbUser, error) {
+	args := m.Called()
+	return args.Get(0).([]models.DbUser), args.Error(1)
+}
+func (m *mockUserRepo) SetUserDisabled(id string, disabled bool) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *mockUserRepo) SetUserStatus(id string, status, text, emoji string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockUserRepo) GetUserStatuses(ids []string) (map[string]models.UserStatus, error) {
+	args := m.Called()
+	return args.Get(0).(map[string]models.UserStatus), args.Error(1)
+}
+func (m *mockUserRepo) SetLastSeen(id string, lastSeen time.Time) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockUserRepo) ListUsers(prefix string, after string, limit int) ([]models.UserSummary, error) {
+	args := m.Called()
+	return args.Get(0).([]models.UserSummary), args.Error(1)
+}
+func (m *mockUserRepo) CountUsers() (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+func (m *mockUserRepo) FindProfile(id string) (models.Profile, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(models.Profile), args.Error(1)
+}
+func (m *mockUserRepo) UpdateProfile(id string, displayName, bio, timezone string) error {
+	args := m.Called(displayName, bio, timezone)
+	return args.Error(0)
+}
+func (m *mockUserRepo) SetAvatar(id string, avatar string) error {
+	args := m.Called(avatar)
+	return args.Error(0)
+}
 
 func TestRegistrationOk(t *testing.T) {
 	data := []byte(`{
@@ -184,3 +238,28 @@ func TestLoginInvalidPassword(t *testing.T) {
 
 	assert.Equal(t, http.StatusForbidden, resp.Code)
 }
+
+func TestLoginDisabled(t *testing.T) {
+	pwd, _ := auth.NewAuth().GeneratePassword("123456")
+	disabledUser := &repository.User{
+		Id:       "3",
+		Name:     "disabled",
+		Username: "disabled",
+		Password: pwd,
+		Disabled: true,
+	}
+
+	data := []byte(`{
+		"username": "` + disabledUser.Username + `",
+		"password": "123456"
+	}`)
+	userRepo.On("FindUserByUsername").Once().Return(disabledUser, nil)
+
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(data))
+	handler := http.HandlerFunc(api.Login)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/nagohak/chat-app/auth"
+	"github.com/nagohak/chat-app/dto"
+	"github.com/nagohak/chat-app/models"
+	"github.com/nagohak/chat-app/pkg/storage"
+	"github.com/nagohak/chat-app/pkg/thumbnail"
+)
+
+const (
+	maxAttachmentSize    = 25 << 20
+	maxAttachmentNameLen = 255
+	thumbnailSize        = 320
+
+	attachmentKey          = "attachments/%s"
+	attachmentFileKey      = attachmentKey + "/file"
+	attachmentThumbnailKey = attachmentKey + "/thumbnail.png"
+)
+
+type AttachmentApi struct {
+	attachmentRepository models.AttachmentRepository
+	roomRepository       models.RoomRepository
+	messageRepository    models.MessageRepository
+	storage              storage.Storage
+}
+
+func NewAttachmentApi(attachmentRepository models.AttachmentRepository, roomRepository models.RoomRepository,
+	messageRepository models.MessageRepository, storage storage.Storage) *AttachmentApi {
+	return &AttachmentApi{
+		attachmentRepository: attachmentRepository,
+		roomRepository:       roomRepository,
+		messageRepository:    messageRepository,
+		storage:              storage,
+	}
+}
+
+// Upload stores the file uploaded in the file form field. The returned ID can be sent along
+// with a message, images get a thumbnail.
+func (api *AttachmentApi) Upload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := r.Context().Value(auth.UserContextKey).(models.User)
+
+	// Leave some room for the rest of the multipart body.
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		errorResponse(w, "File is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxAttachmentSize {
+		errorResponse(w, "File is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	name := attachmentName(header.Filename)
+
+	// The type is sniffed from the content, the one the client claims is not trusted.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mimeType := http.DetectContentType(head[:n])
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id := uuid.New().String()
+	if err := api.storage.Put(fmt.Sprintf(attachmentFileKey, id), file); err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hasThumbnail := false
+	if strings.HasPrefix(mimeType, "image/") {
+		hasThumbnail = api.storeThumbnail(id, file)
+	}
+
+	if err := api.attachmentRepository.AddAttachment(id, user.GetID(), name, mimeType, header.Size, hasThumbnail); err != nil {
+		api.storage.Delete(AttachmentBlobs(id))
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	attachment, err := api.attachmentRepository.FindAttachment(id)
+	if err != nil || attachment == nil {
+		errorResponse(w, "Attachment not found", http.StatusInternalServerError)
+		return
+	}
+
+	createdResponse(w, dto.NewAttachmentInfo(attachment))
+}
+
+// Download serves /api/attachments/{id} and /api/attachments/{id}/thumbnail to the
+// uploader and the members of the room the attachment was sent to.
+func (api *AttachmentApi) Download(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, wantThumbnail, ok := attachmentPath(r.URL.Path)
+	if !ok {
+		errorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	user := r.Context().Value(auth.UserContextKey).(models.User)
+
+	attachment, err := api.attachmentRepository.FindAttachment(id)
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if attachment == nil || (wantThumbnail && !attachment.GetThumbnail()) {
+		errorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if status, err := api.downloadAccess(attachment, user.GetID()); err != nil {
+		errorResponse(w, err.Error(), status)
+		return
+	}
+
+	key := fmt.Sprintf(attachmentFileKey, attachment.GetId())
+	if wantThumbnail {
+		key = fmt.Sprintf(attachmentThumbnailKey, attachment.GetId())
+	}
+
+	blob, err := api.storage.Open(key)
+	if err == storage.ErrNotFound {
+		errorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+
+	if wantThumbnail {
+		w.Header().Set("Content-Type", "image/png")
+	} else {
+		w.Header().Set("Content-Type", attachment.GetMimeType())
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.GetSize(), 10))
+
+		// Only images are shown inline, anything else could be a page running on our origin.
+		disposition := "attachment"
+		if strings.HasPrefix(attachment.GetMimeType(), "image/") {
+			disposition = "inline"
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.GetName()}))
+	}
+
+	io.Copy(w, blob)
+}
+
+// downloadAccess checks the user may download the attachment: nobody once its message is
+// deleted, the uploader always otherwise, others have to be members of the room it was
+// sent to and must not be banned.
+func (api *AttachmentApi) downloadAccess(attachment models.Attachment, userId string) (int, error) {
+	if attachment.GetMessageId() != "" {
+		message, err := api.messageRepository.FindMessageById(attachment.GetMessageId())
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if message == nil || message.GetDeleted() {
+			return http.StatusNotFound, ErrNotFound
+		}
+	}
+
+	if attachment.GetUploaderId() == userId {
+		return http.StatusOK, nil
+	}
+
+	// Attachments that were not sent yet are only known to the uploader.
+	if attachment.GetRoomId() == "" {
+		return http.StatusNotFound, ErrNotFound
+	}
+
+	banned, _, err := api.roomRepository.GetSanction(attachment.GetRoomId(), userId, models.SanctionBan)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if banned {
+		return http.StatusForbidden, ErrForbidden
+	}
+
+	member, err := api.roomRepository.IsRoomMember(attachment.GetRoomId(), userId)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !member {
+		return http.StatusForbidden, ErrForbidden
+	}
+
+	return http.StatusOK, nil
+}
+
+// storeThumbnail stores a thumbnail of the image and reports whether it could.
+// Images that cannot be decoded are kept without thumbnail.
+func (api *AttachmentApi) storeThumbnail(id string, file io.ReadSeeker) bool {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+
+	img, err := thumbnail.Decode(file, maxImageSide)
+	if err != nil {
+		return false
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, thumbnail.Fit(img, thumbnailSize)); err != nil {
+		return false
+	}
+
+	return api.storage.Put(fmt.Sprintf(attachmentThumbnailKey, id), &buf) == nil
+}
+
+// AttachmentBlobs is the storage prefix of the file and thumbnail of the attachment.
+func AttachmentBlobs(id string) string {
+	return fmt.Sprintf(attachmentKey, id)
+}
+
+// attachmentPath extracts the attachment ID from /api/attachments/{id} and /api/attachments/{id}/thumbnail.
+func attachmentPath(path string) (string, bool, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 3 || len(parts) > 4 || parts[0] != "api" || parts[1] != "attachments" || parts[2] == "" {
+		return "", false, false
+	}
+
+	if len(parts) == 4 {
+		return parts[2], true, parts[3] == "thumbnail"
+	}
+
+	return parts[2], false, true
+}
+
+// attachmentName keeps the base name of the uploaded file, limited in length.
+func attachmentName(filename string) string {
+	name := filepath.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if name == "." || name == "/" {
+		name = "file"
+	}
+
+	for utf8.RuneCountInString(name) > maxAttachmentNameLen {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return name
+}
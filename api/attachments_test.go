@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nagohak/chat-app/dto"
+	"github.com/nagohak/chat-app/models"
+	"github.com/nagohak/chat-app/pkg/storage"
+	"github.com/nagohak/chat-app/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockAttachmentRepo struct {
+	mock.Mock
+}
+
+func (m *mockAttachmentRepo) AddAttachment(id string, uploaderId string, name string, mimeType string, size int64, thumbnail bool) error {
+	args := m.Called(uploaderId, name, mimeType, size, thumbnail)
+	return args.Error(0)
+}
+func (m *mockAttachmentRepo) FindAttachment(id string) (models.Attachment, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(models.Attachment), args.Error(1)
+}
+func (m *mockAttachmentRepo) AttachToMessage(ids []string, uploaderId string, roomId string, messageId string) ([]models.Attachment, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Attachment), args.Error(1)
+}
+func (m *mockAttachmentRepo) GetMessageAttachments(messageIds []string) (map[string][]models.Attachment, error) {
+	args := m.Called()
+	return args.Get(0).(map[string][]models.Attachment), args.Error(1)
+}
+func (m *mockAttachmentRepo) DeleteMessageAttachments(messageId string) ([]string, error) {
+	args := m.Called(messageId)
+	return args.Get(0).([]string), args.Error(1)
+}
+func (m *mockAttachmentRepo) DeleteRoomAttachments(roomId string) ([]string, error) {
+	args := m.Called(roomId)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+type attachmentMocks struct {
+	attachments *mockAttachmentRepo
+	rooms       *mockRoomRepo
+	messages    *mockMessageRepo
+}
+
+func newAttachmentApi(t *testing.T) (*AttachmentApi, attachmentMocks) {
+	blobs, err := storage.NewLocal(t.TempDir())
+	assert.NoError(t, err)
+
+	mocks := attachmentMocks{
+		attachments: new(mockAttachmentRepo),
+		rooms:       new(mockRoomRepo),
+		messages:    new(mockMessageRepo),
+	}
+	return NewAttachmentApi(mocks.attachments, mocks.rooms, mocks.messages, blobs), mocks
+}
+
+var sentMessage = &repository.Message{Id: "m1", RoomId: "r1", SenderId: "2", SenderName: "other", Message: "see attached"}
+
+func TestAttachmentUploadImage(t *testing.T) {
+	attachmentApi, mocks := newAttachmentApi(t)
+
+	var img bytes.Buffer
+	assert.NoError(t, png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 640, 480))))
+	size := int64(img.Len())
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "../holiday.png")
+	part.Write(img.Bytes())
+	form.Close()
+
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	mocks.attachments.On("AddAttachment", user.Id, "holiday.png", "image/png", size, true).Once().Return(nil)
+	mocks.attachments.On("FindAttachment").Once().Return(&repository.Attachment{
+		Id: "a1", UploaderId: user.Id, Name: "holiday.png", MimeType: "image/png", Size: size, Thumbnail: true,
+	}, nil)
+
+	req := userRequest(t, "POST", "/api/attachments", body.Bytes())
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	handler := api.TokenMiddleware(attachmentApi.Upload)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	mocks.attachments.AssertExpectations(t)
+
+	var info dto.AttachmentInfo
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, "a1", info.Id)
+	assert.Equal(t, "/api/attachments/a1/thumbnail", info.ThumbnailUrl)
+}
+
+func TestAttachmentDownloadMember(t *testing.T) {
+	attachmentApi, mocks := newAttachmentApi(t)
+	assert.NoError(t, attachmentApi.storage.Put("attachments/a1/file", bytes.NewBufferString("hello")))
+
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	mocks.attachments.On("FindAttachment").Once().Return(&repository.Attachment{
+		Id: "a1", UploaderId: "2", RoomId: "r1", MessageId: "m1", Name: "notes.txt", MimeType: "text/plain; charset=utf-8", Size: 5,
+	}, nil)
+	mocks.messages.On("FindMessageById").Once().Return(sentMessage, nil)
+	mocks.rooms.On("GetSanction").Once().Return(false, time.Time{}, nil)
+	mocks.rooms.On("IsRoomMember").Once().Return(true, nil)
+
+	req := userRequest(t, "GET", "/api/attachments/a1", nil)
+	handler := api.TokenMiddleware(attachmentApi.Download)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "hello", resp.Body.String())
+	assert.Equal(t, "nosniff", resp.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, `attachment; filename=notes.txt`, resp.Header().Get("Content-Disposition"))
+}
+
+func TestAttachmentDownloadNotMember(t *testing.T) {
+	attachmentApi, mocks := newAttachmentApi(t)
+
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	mocks.attachments.On("FindAttachment").Once().Return(&repository.Attachment{
+		Id: "a1", UploaderId: "2", RoomId: "r1", MessageId: "m1", Name: "notes.txt", MimeType: "text/plain", Size: 5,
+	}, nil)
+	mocks.messages.On("FindMessageById").Once().Return(sentMessage, nil)
+	mocks.rooms.On("GetSanction").Once().Return(false, time.Time{}, nil)
+	mocks.rooms.On("IsRoomMember").Once().Return(false, nil)
+
+	req := userRequest(t, "GET", "/api/attachments/a1", nil)
+	handler := api.TokenMiddleware(attachmentApi.Download)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestAttachmentDownloadUnsent(t *testing.T) {
+	attachmentApi, mocks := newAttachmentApi(t)
+
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	mocks.attachments.On("FindAttachment").Once().Return(&repository.Attachment{
+		Id: "a1", UploaderId: "2", Name: "notes.txt", MimeType: "text/plain", Size: 5,
+	}, nil)
+
+	req := userRequest(t, "GET", "/api/attachments/a1", nil)
+	handler := api.TokenMiddleware(attachmentApi.Download)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestAttachmentDownloadDeletedMessage(t *testing.T) {
+	attachmentApi, mocks := newAttachmentApi(t)
+	assert.NoError(t, attachmentApi.storage.Put("attachments/a1/file", bytes.NewBufferString("hello")))
+
+	deleted := *sentMessage
+	deleted.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	mocks.attachments.On("FindAttachment").Once().Return(&repository.Attachment{
+		Id: "a1", UploaderId: user.Id, RoomId: "r1", MessageId: "m1", Name: "notes.txt", MimeType: "text/plain", Size: 5,
+	}, nil)
+	mocks.messages.On("FindMessageById").Once().Return(&deleted, nil)
+
+	req := userRequest(t, "GET", "/api/attachments/a1", nil)
+	handler := api.TokenMiddleware(attachmentApi.Download)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
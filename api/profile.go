@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/nagohak/chat-app/auth"
+	"github.com/nagohak/chat-app/dto"
+	"github.com/nagohak/chat-app/models"
+	"github.com/nagohak/chat-app/pkg/storage"
+	"github.com/nagohak/chat-app/pkg/thumbnail"
+)
+
+const (
+	maxDisplayNameLength = 64
+	maxBioLength         = 500
+
+	maxAvatarUploadSize = 5 << 20
+	// Larger images are rejected before decoding them
+	maxImageSide = 4096
+
+	avatarKey = "avatars/%s"
+)
+
+// Notifier is the part of the chat server that tells others about profile changes.
+type Notifier interface {
+	// UserUpdated sends the profile of the user to every room the user belongs to.
+	UserUpdated(userId string)
+}
+
+type ProfileUpdate struct {
+	DisplayName string `json:"displayName"`
+	Bio         string `json:"bio"`
+	Timezone    string `json:"timezone"`
+}
+
+type ProfileApi struct {
+	userRepository models.UserRepository
+	storage        storage.Storage
+	notifier       Notifier
+}
+
+func NewProfileApi(userRepository models.UserRepository, storage storage.Storage, notifier Notifier) *ProfileApi {
+	return &ProfileApi{
+		userRepository: userRepository,
+		storage:        storage,
+		notifier:       notifier,
+	}
+}
+
+// Profile returns the profile of the user on GET and updates it on PUT.
+func (api *ProfileApi) Profile(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(auth.UserContextKey).(models.User)
+
+	switch r.Method {
+	case http.MethodGet:
+		api.profileResponse(w, user)
+	case http.MethodPut:
+		api.updateProfile(w, r, user)
+	default:
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// UserProfile serves the profile of any user at /api/users/{id}/profile.
+func (api *ProfileApi) UserProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "api" || parts[1] != "users" || parts[2] == "" || parts[3] != "profile" {
+		errorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	user, err := api.userRepository.FindUserById(parts[2])
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		errorResponse(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	api.profileResponse(w, user)
+}
+
+// Avatar replaces the avatar of the user with the image uploaded in the avatar form field.
+func (api *ProfileApi) Avatar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := r.Context().Value(auth.UserContextKey).(models.User)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarUploadSize)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		errorResponse(w, "Avatar image is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	img, err := thumbnail.Decode(file, maxImageSide)
+	if err != nil {
+		errorResponse(w, "Unsupported image", http.StatusBadRequest)
+		return
+	}
+
+	avatar := uuid.New().String()
+	for _, size := range dto.AvatarSizes {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, thumbnail.Square(img, size)); err != nil {
+			errorResponse(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := api.storage.Put(avatarImageKey(avatar, size), &buf); err != nil {
+			errorResponse(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	previous, err := api.userRepository.FindProfile(user.GetID())
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := api.userRepository.SetAvatar(user.GetID(), avatar); err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if previous != nil && previous.GetAvatar() != "" {
+		api.storage.Delete(fmt.Sprintf(avatarKey, previous.GetAvatar()))
+	}
+
+	api.notifier.UserUpdated(user.GetID())
+	api.profileResponse(w, user)
+}
+
+// AvatarImage serves /api/avatars/{avatar}/{size}.png. Avatar IDs change on every upload,
+// so the images can be cached forever.
+func (api *ProfileApi) AvatarImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "api" || parts[1] != "avatars" {
+		errorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	avatar, err := uuid.Parse(parts[2])
+	size, sizeErr := strconv.Atoi(strings.TrimSuffix(parts[3], ".png"))
+	if err != nil || sizeErr != nil || !strings.HasSuffix(parts[3], ".png") || !isAvatarSize(size) {
+		errorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	blob, err := api.storage.Open(avatarImageKey(avatar.String(), size))
+	if err == storage.ErrNotFound {
+		errorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	io.Copy(w, blob)
+}
+
+func (api *ProfileApi) updateProfile(w http.ResponseWriter, r *http.Request, user models.User) {
+	var update ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	update.DisplayName = strings.TrimSpace(update.DisplayName)
+	update.Bio = strings.TrimSpace(update.Bio)
+	update.Timezone = strings.TrimSpace(update.Timezone)
+
+	if utf8.RuneCountInString(update.DisplayName) > maxDisplayNameLength {
+		errorResponse(w, "Display name is too long", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(update.Bio) > maxBioLength {
+		errorResponse(w, "Bio is too long", http.StatusBadRequest)
+		return
+	}
+	if update.Timezone != "" {
+		if _, err := time.LoadLocation(update.Timezone); err != nil {
+			errorResponse(w, "Unknown timezone", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := api.userRepository.UpdateProfile(user.GetID(), update.DisplayName, update.Bio, update.Timezone); err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	api.notifier.UserUpdated(user.GetID())
+	api.profileResponse(w, user)
+}
+
+func (api *ProfileApi) profileResponse(w http.ResponseWriter, user models.User) {
+	profile, err := api.userRepository.FindProfile(user.GetID())
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if profile == nil {
+		errorResponse(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	jsonResponse(w, dto.NewProfileInfo(user, profile))
+}
+
+func avatarImageKey(avatar string, size int) string {
+	return fmt.Sprintf(avatarKey+"/%d.png", avatar, size)
+}
+
+func isAvatarSize(size int) bool {
+	for _, avatarSize := range dto.AvatarSizes {
+		if size == avatarSize {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nagohak/chat-app/dto"
+	"github.com/nagohak/chat-app/pkg/storage"
+	"github.com/nagohak/chat-app/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockNotifier struct {
+	mock.Mock
+}
+
+func (m *mockNotifier) UserUpdated(userId string) {
+	m.Called(userId)
+}
+
+func newProfileApi(t *testing.T) (*ProfileApi, *mockNotifier) {
+	blobs, err := storage.NewLocal(t.TempDir())
+	assert.NoError(t, err)
+
+	notifier := new(mockNotifier)
+	return NewProfileApi(userRepo, blobs, notifier), notifier
+}
+
+func TestProfileUpdate(t *testing.T) {
+	profileApi, notifier := newProfileApi(t)
+
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	userRepo.On("UpdateProfile", "Tess", "Builds things", "Europe/Amsterdam").Once().Return(nil)
+	userRepo.On("FindProfile").Once().Return(&repository.Profile{DisplayName: "Tess", Bio: "Builds things", Timezone: "Europe/Amsterdam"}, nil)
+	notifier.On("UserUpdated", user.Id).Once()
+
+	data := []byte(`{"displayName": " Tess ", "bio": "Builds things", "timezone": "Europe/Amsterdam"}`)
+	req := userRequest(t, "PUT", "/api/profile", data)
+	handler := api.TokenMiddleware(profileApi.Profile)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var profile dto.ProfileInfo
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&profile))
+	assert.Equal(t, "Tess", profile.DisplayName)
+	assert.Equal(t, "Europe/Amsterdam", profile.Timezone)
+	notifier.AssertExpectations(t)
+}
+
+func TestProfileUpdateUnknownTimezone(t *testing.T) {
+	profileApi, _ := newProfileApi(t)
+
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+
+	data := []byte(`{"displayName": "Tess", "timezone": "Mars/Olympus"}`)
+	req := userRequest(t, "PUT", "/api/profile", data)
+	handler := api.TokenMiddleware(profileApi.Profile)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestProfileAvatarUpload(t *testing.T) {
+	profileApi, notifier := newProfileApi(t)
+
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 300; y++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("avatar", "me.png")
+	assert.NoError(t, png.Encode(part, img))
+	form.Close()
+
+	var avatar string
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	userRepo.On("FindProfile").Once().Return(&repository.Profile{}, nil)
+	userRepo.On("SetAvatar", mock.Anything).Once().Return(nil).Run(func(args mock.Arguments) {
+		avatar = args.String(0)
+	})
+	userRepo.On("FindProfile").Once().Return(&repository.Profile{}, nil)
+	notifier.On("UserUpdated", user.Id).Once()
+
+	req := userRequest(t, "POST", "/api/profile/avatar", body.Bytes())
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	handler := api.TokenMiddleware(profileApi.Avatar)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	notifier.AssertExpectations(t)
+
+	for _, size := range dto.AvatarSizes {
+		blob, err := profileApi.storage.Open(avatarImageKey(avatar, size))
+		assert.NoError(t, err)
+
+		thumbnail, err := png.Decode(blob)
+		blob.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, size, thumbnail.Bounds().Dx())
+		assert.Equal(t, size, thumbnail.Bounds().Dy())
+	}
+}
+
+func TestProfileAvatarUploadNotAnImage(t *testing.T) {
+	profileApi, _ := newProfileApi(t)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("avatar", "me.png")
+	part.Write([]byte("not an image"))
+	form.Close()
+
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+
+	req := userRequest(t, "POST", "/api/profile/avatar", body.Bytes())
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	handler := api.TokenMiddleware(profileApi.Avatar)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestAvatarImage(t *testing.T) {
+	profileApi, _ := newProfileApi(t)
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+
+	avatar := "6f1c2d9e-93b5-4c35-8a8e-3f4f2f5c7a10"
+	assert.NoError(t, profileApi.storage.Put(avatarImageKey(avatar, 64), &buf))
+
+	req, _ := http.NewRequest("GET", "/api/avatars/"+avatar+"/64.png", nil)
+	resp := httptest.NewRecorder()
+	http.HandlerFunc(profileApi.AvatarImage).ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "image/png", resp.Header().Get("Content-Type"))
+
+	decoded, err := png.Decode(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, 64, decoded.Bounds().Dx())
+
+	req, _ = http.NewRequest("GET", "/api/avatars/"+avatar+"/65.png", nil)
+	resp = httptest.NewRecorder()
+	http.HandlerFunc(profileApi.AvatarImage).ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
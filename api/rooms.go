@@ -0,0 +1,417 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nagohak/chat-app/auth"
+	"github.com/nagohak/chat-app/dto"
+	"github.com/nagohak/chat-app/models"
+)
+
+// MaxMessageSize limits the messages posted through the API, like the websocket read limit does.
+const MaxMessageSize = 10000
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+	ErrInvalid   = errors.New("invalid")
+)
+
+// Chat is the part of the chat server the REST API posts through, so websocket
+// clients see REST messages live.
+type Chat interface {
+	// CreateRoom returns ErrInvalid for names that are empty, too long or reserved.
+	CreateRoom(name string, private bool, owner models.User) (models.Room, error)
+	// PostMessage returns ErrNotFound for unknown rooms and ErrForbidden when the sender may not post.
+	PostMessage(roomId string, sender models.User, text string) (models.Message, error)
+	// CreateInvite returns a signed invite token. Zero maxUses and ttl mean no limit.
+	CreateInvite(roomId string, creator models.User, role string, maxUses int, ttl time.Duration) (string, error)
+	// RedeemInvite adds the user to the room of the invite, returning ErrForbidden for
+	// invalid, expired or used up invites.
+	RedeemInvite(token string, user models.User) (models.Room, error)
+	// JoinRoom adds the user to a public room, returning ErrForbidden for private rooms
+	// the user is not a member of, archived rooms and banned users.
+	JoinRoom(roomId string, user models.User) (models.Room, error)
+}
+
+type NewRoom struct {
+	Name    string `json:"name"`
+	Private bool   `json:"private"`
+}
+
+type NewMessage struct {
+	Message string `json:"message"`
+}
+
+type NewInvite struct {
+	Role    string `json:"role"`
+	MaxUses int    `json:"maxUses"`
+	// ExpiresIn is the number of seconds the invite is valid, zero meaning forever
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+type InviteToken struct {
+	Token string `json:"token"`
+}
+
+type MessageSender struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type MessageInfo struct {
+	Id          string               `json:"id"`
+	RoomId      string               `json:"roomId"`
+	Sender      MessageSender        `json:"sender"`
+	Message     string               `json:"message"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	Seq         int64                `json:"seq"`
+	EditedAt    *time.Time           `json:"editedAt,omitempty"`
+	Deleted     bool                 `json:"deleted,omitempty"`
+	ReplyTo     string               `json:"replyTo,omitempty"`
+	Attachments []dto.AttachmentInfo `json:"attachments,omitempty"`
+}
+
+type RoomApi struct {
+	roomRepository       models.RoomRepository
+	messageRepository    models.MessageRepository
+	attachmentRepository models.AttachmentRepository
+	chat                 Chat
+	auth                 auth.Auth
+}
+
+func NewRoomApi(roomRepository models.RoomRepository, messageRepository models.MessageRepository,
+	attachmentRepository models.AttachmentRepository, chat Chat, auth auth.Auth) *RoomApi {
+	return &RoomApi{
+		roomRepository:       roomRepository,
+		messageRepository:    messageRepository,
+		attachmentRepository: attachmentRepository,
+		chat:                 chat,
+		auth:                 auth,
+	}
+}
+
+// Rooms lists the rooms of the user on GET and creates a room owned by the user on POST.
+func (api *RoomApi) Rooms(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(auth.UserContextKey).(models.User)
+
+	switch r.Method {
+	case http.MethodGet:
+		dbRooms, err := api.roomRepository.GetUserRooms(user.GetID())
+		if err != nil {
+			errorResponse(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, roomInfos(dbRooms))
+	case http.MethodPost:
+		api.createRoom(w, r, user)
+	default:
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (api *RoomApi) createRoom(w http.ResponseWriter, r *http.Request, user models.User) {
+	var newRoom NewRoom
+	if err := json.NewDecoder(r.Body).Decode(&newRoom); err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newRoom.Name = strings.TrimSpace(newRoom.Name)
+	if newRoom.Name == "" {
+		errorResponse(w, "Room name is required", http.StatusBadRequest)
+		return
+	}
+
+	dbRoom, err := api.roomRepository.FindRoomByName(newRoom.Name)
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if dbRoom != nil {
+		errorResponse(w, "Room already exists", http.StatusConflict)
+		return
+	}
+
+	room, err := api.chat.CreateRoom(newRoom.Name, newRoom.Private, user)
+	if err == ErrInvalid {
+		errorResponse(w, "Invalid room name", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	createdResponse(w, roomInfos([]models.Room{room})[0])
+}
+
+// Directory lists public rooms whose name starts with ?query=, paginated with ?limit= and ?offset=.
+func (api *RoomApi) Directory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, offset := pagination(r)
+
+	dbRooms, err := api.roomRepository.ListPublicRooms(r.URL.Query().Get("query"), limit, offset)
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, dto.NewRoomListings(dbRooms))
+}
+
+// RoomResources serves /api/rooms/{id}/messages, /api/rooms/{id}/invites and /api/rooms/{id}/members.
+// GET messages returns a page of history before the ?before= sequence number, POST
+// messages sends a message to the room, POST invites mints an invite token and POST
+// members joins the user to the room.
+func (api *RoomApi) RoomResources(w http.ResponseWriter, r *http.Request) {
+	roomId, resource, ok := roomPath(r.URL.Path)
+	if !ok {
+		errorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	user := r.Context().Value(auth.UserContextKey).(models.User)
+
+	switch {
+	case resource == "messages" && r.Method == http.MethodGet:
+		api.listMessages(w, r, roomId, user)
+	case resource == "messages" && r.Method == http.MethodPost:
+		api.postMessage(w, r, roomId, user)
+	case resource == "invites" && r.Method == http.MethodPost:
+		api.createInvite(w, r, roomId, user)
+	case resource == "members" && r.Method == http.MethodPost:
+		api.joinRoom(w, roomId, user)
+	default:
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RedeemInvite joins the user to the room of the invite token in the request body.
+func (api *RoomApi) RedeemInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var invite InviteToken
+	if err := json.NewDecoder(r.Body).Decode(&invite); err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user := r.Context().Value(auth.UserContextKey).(models.User)
+
+	room, err := api.chat.RedeemInvite(invite.Token, api.auth.NewUser(user.GetID(), user.GetName()))
+	if err != nil {
+		chatErrorResponse(w, err, "Invite is invalid, expired or used up")
+		return
+	}
+
+	jsonResponse(w, roomInfos([]models.Room{room})[0])
+}
+
+func (api *RoomApi) joinRoom(w http.ResponseWriter, roomId string, user models.User) {
+	room, err := api.chat.JoinRoom(roomId, api.auth.NewUser(user.GetID(), user.GetName()))
+	if err != nil {
+		chatErrorResponse(w, err, "Not allowed to join this room")
+		return
+	}
+
+	jsonResponse(w, roomInfos([]models.Room{room})[0])
+}
+
+func (api *RoomApi) createInvite(w http.ResponseWriter, r *http.Request, roomId string, user models.User) {
+	var newInvite NewInvite
+	if err := json.NewDecoder(r.Body).Decode(&newInvite); err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ttl := time.Duration(newInvite.ExpiresIn) * time.Second
+
+	token, err := api.chat.CreateInvite(roomId, user, newInvite.Role, newInvite.MaxUses, ttl)
+	if err != nil {
+		chatErrorResponse(w, err, "Not allowed to create invites for this room")
+		return
+	}
+
+	createdResponse(w, InviteToken{Token: token})
+}
+
+func (api *RoomApi) listMessages(w http.ResponseWriter, r *http.Request, roomId string, user models.User) {
+	var before int64
+	if cursor := r.URL.Query().Get("before"); cursor != "" {
+		var err error
+		if before, err = strconv.ParseInt(cursor, 10, 64); err != nil {
+			errorResponse(w, "Invalid before cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	status, err := api.readAccess(roomId, user.GetID())
+	if err != nil {
+		errorResponse(w, err.Error(), status)
+		return
+	}
+
+	limit, _ := pagination(r)
+
+	dbMessages, err := api.messageRepository.GetRoomMessages(roomId, before, limit)
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Deleted messages keep no attachments.
+	ids := make([]string, 0, len(dbMessages))
+	for _, dbMessage := range dbMessages {
+		if !dbMessage.GetDeleted() {
+			ids = append(ids, dbMessage.GetId())
+		}
+	}
+
+	attachments := map[string][]models.Attachment{}
+	if len(ids) > 0 {
+		if attachments, err = api.attachmentRepository.GetMessageAttachments(ids); err != nil {
+			errorResponse(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	messages := make([]MessageInfo, 0, len(dbMessages))
+	for _, dbMessage := range dbMessages {
+		info := messageInfo(dbMessage)
+		for _, attachment := range attachments[dbMessage.GetId()] {
+			info.Attachments = append(info.Attachments, dto.NewAttachmentInfo(attachment))
+		}
+		messages = append(messages, info)
+	}
+
+	jsonResponse(w, messages)
+}
+
+// readAccess checks the user may read the room: it has to exist, the user must not be
+// banned and private rooms are only readable by members.
+func (api *RoomApi) readAccess(roomId string, userId string) (int, error) {
+	dbRoom, err := api.roomRepository.FindRoomById(roomId)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if dbRoom == nil {
+		return http.StatusNotFound, ErrNotFound
+	}
+
+	banned, _, err := api.roomRepository.GetSanction(roomId, userId, models.SanctionBan)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if banned {
+		return http.StatusForbidden, ErrForbidden
+	}
+
+	if dbRoom.GetPrivate() {
+		member, err := api.roomRepository.IsRoomMember(roomId, userId)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !member {
+			return http.StatusForbidden, ErrForbidden
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+func (api *RoomApi) postMessage(w http.ResponseWriter, r *http.Request, roomId string, user models.User) {
+	// Leave some room for the JSON around the message.
+	r.Body = http.MaxBytesReader(w, r.Body, MaxMessageSize+1<<10)
+
+	var newMessage NewMessage
+	if err := json.NewDecoder(r.Body).Decode(&newMessage); err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(newMessage.Message) == "" {
+		errorResponse(w, "Message is required", http.StatusBadRequest)
+		return
+	}
+
+	if len(newMessage.Message) > MaxMessageSize {
+		errorResponse(w, "Message is too long", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Only the public part of the user is sent along with the message.
+	sender := api.auth.NewUser(user.GetID(), user.GetName())
+
+	message, err := api.chat.PostMessage(roomId, sender, newMessage.Message)
+	if err != nil {
+		chatErrorResponse(w, err, "Not allowed to post in this room")
+		return
+	}
+
+	createdResponse(w, messageInfo(message))
+}
+
+// chatErrorResponse maps the errors of Chat to HTTP statuses, using forbidden as the message for ErrForbidden.
+func chatErrorResponse(w http.ResponseWriter, err error, forbidden string) {
+	switch err {
+	case ErrNotFound:
+		errorResponse(w, "Room not found", http.StatusNotFound)
+	case ErrForbidden:
+		errorResponse(w, forbidden, http.StatusForbidden)
+	case ErrInvalid:
+		errorResponse(w, "Invalid request", http.StatusBadRequest)
+	default:
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// roomPath extracts the room ID and the resource from /api/rooms/{id}/{resource}.
+func roomPath(path string) (string, string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "api" || parts[1] != "rooms" || parts[2] == "" {
+		return "", "", false
+	}
+
+	switch parts[3] {
+	case "messages", "invites", "members":
+		return parts[2], parts[3], true
+	}
+
+	return "", "", false
+}
+
+func messageInfo(message models.Message) MessageInfo {
+	info := MessageInfo{
+		Id:     message.GetId(),
+		RoomId: message.GetRoomId(),
+		Sender: MessageSender{
+			Id:   message.GetSender().GetID(),
+			Name: message.GetSender().GetName(),
+		},
+		Message:   message.GetMessage(),
+		CreatedAt: message.GetCreatedAt(),
+		Seq:       message.GetSeq(),
+		Deleted:   message.GetDeleted(),
+		ReplyTo:   message.GetReplyTo(),
+	}
+
+	if editedAt := message.GetEditedAt(); !editedAt.IsZero() {
+		info.EditedAt = &editedAt
+	}
+
+	return info
+}
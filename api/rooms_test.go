@@ -0,0 +1,400 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nagohak/chat-app/dto"
+	"github.com/nagohak/chat-app/models"
+	"github.com/nagohak/chat-app/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	messageRepo    = new(mockMessageRepo)
+	attachmentRepo = new(mockAttachmentRepo)
+	chat           = new(mockChat)
+	roomApi        = NewRoomApi(roomRepo, messageRepo, attachmentRepo, chat, authService)
+)
+
+var room = &repository.Room{
+	Id:   "10",
+	Name: "builds",
+}
+
+type mockMessageRepo struct {
+	mock.Mock
+}
+
+func (m *mockMessageRepo) AddMessage(message models.Message) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockMessageRepo) GetRoomMessages(roomId string, beforeSeq int64, limit int) ([]models.Message, error) {
+	args := m.Called(roomId, beforeSeq)
+	return args.Get(0).([]models.Message), args.Error(1)
+}
+func (m *mockMessageRepo) GetRoomMessagesAfter(roomId string, afterSeq int64, limit int) ([]models.Message, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Message), args.Error(1)
+}
+func (m *mockMessageRepo) GetThreadMessages(parentId string, beforeSeq int64, limit int) ([]models.Message, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Message), args.Error(1)
+}
+func (m *mockMessageRepo) AddThreadParticipant(messageId string, userId string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockMessageRepo) RemoveThreadParticipant(messageId string, userId string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockMessageRepo) GetThreadParticipants(messageId string) ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+func (m *mockMessageRepo) FindMessageById(id string) (models.Message, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(models.Message), args.Error(1)
+}
+func (m *mockMessageRepo) EditMessage(id string, text string, editedAt time.Time) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockMessageRepo) DeleteMessage(id string, deletedAt time.Time) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockMessageRepo) GetLastSeq(roomId string) (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type mockChat struct {
+	mock.Mock
+}
+
+func (m *mockChat) CreateRoom(name string, private bool, owner models.User) (models.Room, error) {
+	args := m.Called(name, private)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(models.Room), args.Error(1)
+}
+func (m *mockChat) PostMessage(roomId string, sender models.User, text string) (models.Message, error) {
+	args := m.Called(roomId, text)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(models.Message), args.Error(1)
+}
+
+func (m *mockChat) CreateInvite(roomId string, creator models.User, role string, maxUses int, ttl time.Duration) (string, error) {
+	args := m.Called(roomId, role, maxUses, ttl)
+	return args.String(0), args.Error(1)
+}
+func (m *mockChat) RedeemInvite(token string, user models.User) (models.Room, error) {
+	args := m.Called(token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(models.Room), args.Error(1)
+}
+func (m *mockChat) JoinRoom(roomId string, user models.User) (models.Room, error) {
+	args := m.Called(roomId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(models.Room), args.Error(1)
+}
+
+func userRequest(t *testing.T, method, url string, body []byte) *http.Request {
+	token, err := authService.CreateToken(user)
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest(method, url, bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+func TestRoomsList(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	roomRepo.On("GetUserRooms").Once().Return([]models.Room{room}, nil)
+
+	req := userRequest(t, "GET", "/api/rooms", nil)
+	handler := api.TokenMiddleware(roomApi.Rooms)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var rooms []RoomInfo
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &rooms))
+	assert.Len(t, rooms, 1)
+	assert.Equal(t, room.Id, rooms[0].Id)
+}
+
+func TestRoomsUnauthorizedWithoutToken(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/rooms", nil)
+	handler := api.TokenMiddleware(roomApi.Rooms)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestRoomsCreate(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	roomRepo.On("FindRoomByName").Once().Return(nil, nil)
+	chat.On("CreateRoom", "ci", true).Once().Return(&repository.Room{Id: "11", Name: "ci", Private: true}, nil)
+
+	req := userRequest(t, "POST", "/api/rooms", []byte(`{"name": "ci", "private": true}`))
+	handler := api.TokenMiddleware(roomApi.Rooms)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created RoomInfo
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+	assert.Equal(t, "11", created.Id)
+	assert.True(t, created.Private)
+}
+
+func TestRoomsCreateInvalidName(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	roomRepo.On("FindRoomByName").Once().Return(nil, nil)
+	chat.On("CreateRoom", "dm:1:2", false).Once().Return(nil, ErrInvalid)
+
+	req := userRequest(t, "POST", "/api/rooms", []byte(`{"name": "dm:1:2"}`))
+	handler := api.TokenMiddleware(roomApi.Rooms)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestRoomsCreateExisting(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	roomRepo.On("FindRoomByName").Once().Return(room, nil)
+
+	req := userRequest(t, "POST", "/api/rooms", []byte(`{"name": "builds"}`))
+	handler := api.TokenMiddleware(roomApi.Rooms)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusConflict, resp.Code)
+}
+
+func TestRoomMessagesList(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	roomRepo.On("FindRoomById").Once().Return(room, nil)
+	roomRepo.On("GetSanction").Once().Return(false, time.Time{}, nil)
+	messageRepo.On("GetRoomMessages", room.Id, int64(42)).Once().Return([]models.Message{
+		&repository.Message{Id: "m1", RoomId: room.Id, SenderId: user.Id, SenderName: user.Name, Message: "green", Seq: 41},
+	}, nil)
+	attachmentRepo.On("GetMessageAttachments").Once().Return(map[string][]models.Attachment{
+		"m1": {&repository.Attachment{Id: "a1", UploaderId: user.Id, RoomId: room.Id, MessageId: "m1", Name: "build.log", MimeType: "text/plain", Size: 12}},
+	}, nil)
+
+	req := userRequest(t, "GET", "/api/rooms/"+room.Id+"/messages?before=42", nil)
+	handler := api.TokenMiddleware(roomApi.RoomResources)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var messages []MessageInfo
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &messages))
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "green", messages[0].Message)
+	assert.Equal(t, user.Id, messages[0].Sender.Id)
+	assert.Len(t, messages[0].Attachments, 1)
+	assert.Equal(t, "/api/attachments/a1", messages[0].Attachments[0].Url)
+}
+
+func TestRoomMessagesListPrivateNonMember(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	roomRepo.On("FindRoomById").Once().Return(&repository.Room{Id: "12", Name: "secret", Private: true}, nil)
+	roomRepo.On("GetSanction").Once().Return(false, time.Time{}, nil)
+	roomRepo.On("IsRoomMember").Once().Return(false, nil)
+
+	req := userRequest(t, "GET", "/api/rooms/12/messages", nil)
+	handler := api.TokenMiddleware(roomApi.RoomResources)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestRoomMessagesPost(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	chat.On("PostMessage", room.Id, "build #7 passed").Once().Return(&repository.Message{
+		Id: "m2", RoomId: room.Id, SenderId: user.Id, SenderName: user.Name, Message: "build #7 passed", Seq: 43,
+	}, nil)
+
+	req := userRequest(t, "POST", "/api/rooms/"+room.Id+"/messages", []byte(`{"message": "build #7 passed"}`))
+	handler := api.TokenMiddleware(roomApi.RoomResources)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var message MessageInfo
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &message))
+	assert.Equal(t, int64(43), message.Seq)
+}
+
+func TestRoomMessagesPostForbidden(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	chat.On("PostMessage", room.Id, "hello").Once().Return(nil, ErrForbidden)
+
+	req := userRequest(t, "POST", "/api/rooms/"+room.Id+"/messages", []byte(`{"message": "hello"}`))
+	handler := api.TokenMiddleware(roomApi.RoomResources)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestRoomsDirectory(t *testing.T) {
+	lastActivity := time.Now().UTC()
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	roomRepo.On("ListPublicRooms", "bu").Once().Return([]models.RoomSummary{
+		&repository.RoomSummary{Room: repository.Room{Id: room.Id, Name: room.Name, Topic: "CI results"}, MemberCount: 3, LastActivity: sql.NullTime{Time: lastActivity, Valid: true}},
+		&repository.RoomSummary{Room: repository.Room{Id: "13", Name: "bugs"}},
+	}, nil)
+
+	req := userRequest(t, "GET", "/api/rooms/directory?query=bu", nil)
+	handler := api.TokenMiddleware(roomApi.Directory)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var rooms []dto.RoomListing
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &rooms))
+	assert.Len(t, rooms, 2)
+	assert.Equal(t, 3, rooms[0].MemberCount)
+	assert.Equal(t, "CI results", rooms[0].Topic)
+	assert.NotNil(t, rooms[0].LastActivity)
+	assert.Nil(t, rooms[1].LastActivity)
+}
+
+func TestRoomInvitesCreate(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	chat.On("CreateInvite", room.Id, "moderator", 5, time.Hour).Once().Return("signed-token", nil)
+
+	data := []byte(`{"role": "moderator", "maxUses": 5, "expiresIn": 3600}`)
+	req := userRequest(t, "POST", "/api/rooms/"+room.Id+"/invites", data)
+	handler := api.TokenMiddleware(roomApi.RoomResources)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var invite InviteToken
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &invite))
+	assert.Equal(t, "signed-token", invite.Token)
+}
+
+func TestRedeemInvite(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	chat.On("RedeemInvite", "signed-token").Once().Return(room, nil)
+
+	req := userRequest(t, "POST", "/api/invites/redeem", []byte(`{"token": "signed-token"}`))
+	handler := api.TokenMiddleware(roomApi.RedeemInvite)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var joined RoomInfo
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &joined))
+	assert.Equal(t, room.Id, joined.Id)
+}
+
+func TestRedeemInviteUsedUp(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	chat.On("RedeemInvite", "used-token").Once().Return(nil, ErrForbidden)
+
+	req := userRequest(t, "POST", "/api/invites/redeem", []byte(`{"token": "used-token"}`))
+	handler := api.TokenMiddleware(roomApi.RedeemInvite)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestRoomJoin(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	chat.On("JoinRoom", room.Id).Once().Return(room, nil)
+
+	req := userRequest(t, "POST", "/api/rooms/"+room.Id+"/members", nil)
+	handler := api.TokenMiddleware(roomApi.RoomResources)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var joined RoomInfo
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &joined))
+	assert.Equal(t, room.Id, joined.Id)
+}
+
+func TestRoomJoinPrivate(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	chat.On("JoinRoom", "private-room").Once().Return(nil, ErrForbidden)
+
+	req := userRequest(t, "POST", "/api/rooms/private-room/members", nil)
+	handler := api.TokenMiddleware(roomApi.RoomResources)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestRoomMessagesPostTooLong(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+
+	body, _ := json.Marshal(NewMessage{Message: strings.Repeat("a", MaxMessageSize+1)})
+	req := userRequest(t, "POST", "/api/rooms/"+room.Id+"/messages", body)
+	handler := api.TokenMiddleware(roomApi.RoomResources)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+}
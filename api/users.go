@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/nagohak/chat-app/dto"
+	"github.com/nagohak/chat-app/models"
+)
+
+// Directory is the part of the chat server that lists users along with their presence.
+type Directory interface {
+	// SearchUsers returns users whose name or username starts with query, after the user with the ID cursor.
+	SearchUsers(query string, cursor string, limit int) ([]models.UserSummary, error)
+}
+
+type UserPage struct {
+	Users []dto.UserListing `json:"users"`
+	// NextCursor is passed as ?cursor= to get the next page, it is empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type UserApi struct {
+	directory Directory
+}
+
+func NewUserApi(directory Directory) *UserApi {
+	return &UserApi{directory: directory}
+}
+
+// Users lists users whose name or username starts with ?query=, paginated with ?limit= and ?cursor=.
+func (api *UserApi) Users(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, _ := pagination(r)
+
+	users, err := api.directory.SearchUsers(r.URL.Query().Get("query"), r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := UserPage{Users: dto.NewUserListings(users)}
+	if len(users) == limit {
+		page.NextCursor = users[len(users)-1].GetID()
+	}
+
+	jsonResponse(w, page)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nagohak/chat-app/models"
+	"github.com/nagohak/chat-app/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	directory = new(mockDirectory)
+	userApi   = NewUserApi(directory)
+)
+
+type mockDirectory struct {
+	mock.Mock
+}
+
+func (m *mockDirectory) SearchUsers(query string, cursor string, limit int) ([]models.UserSummary, error) {
+	args := m.Called(query, cursor, limit)
+	return args.Get(0).([]models.UserSummary), args.Error(1)
+}
+
+func TestUsersSearch(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	directory.On("SearchUsers", "te", "", 2).Once().Return([]models.UserSummary{
+		&repository.UserSummary{
+			User:       repository.User{Id: "1", Name: "tester"},
+			UserStatus: repository.UserStatus{Status: "dnd", Text: "deploying"},
+		},
+		&repository.UserSummary{
+			User:       repository.User{Id: "2", Name: "tess"},
+			UserStatus: repository.UserStatus{Status: "offline"},
+		},
+	}, nil)
+
+	req := userRequest(t, "GET", "/api/users?query=te&limit=2", nil)
+	handler := api.TokenMiddleware(userApi.Users)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var page UserPage
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+	assert.Len(t, page.Users, 2)
+	assert.Equal(t, "dnd", page.Users[0].Status)
+	assert.Equal(t, "deploying", page.Users[0].StatusText)
+	assert.Equal(t, "2", page.NextCursor)
+}
+
+func TestUsersSearchLastPage(t *testing.T) {
+	userRepo.On("FindDbUserById").Once().Return(user, nil)
+	directory.On("SearchUsers", "", "2", defaultPageSize).Once().Return([]models.UserSummary{
+		&repository.UserSummary{User: repository.User{Id: "3", Name: "zed"}},
+	}, nil)
+
+	req := userRequest(t, "GET", "/api/users?cursor=2", nil)
+	handler := api.TokenMiddleware(userApi.Users)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var page UserPage
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+	assert.Len(t, page.Users, 1)
+	assert.Empty(t, page.NextCursor)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+
+	"github.com/nagohak/chat-app/models"
+)
+
+const archivedMessage = "This room is archived"
+
+// handleArchiveRoomMessage archives or unarchives the target room.
+func (client *Client) handleArchiveRoomMessage(message Message) {
+	room := client.findManagedRoom(message)
+	if room == nil {
+		return
+	}
+
+	archived := message.Action == ArchiveRoomAction
+	if room.GetArchived() == archived {
+		return
+	}
+
+	if err := client.wsServer.ArchiveRoom(room.GetId(), archived); err != nil {
+		log.Println(err)
+	}
+}
+
+// handleDeleteRoomMessage deletes the target room together with its history.
+func (client *Client) handleDeleteRoomMessage(message Message) {
+	room := client.findManagedRoom(message)
+	if room == nil {
+		return
+	}
+
+	if err := client.wsServer.DeleteRoom(room.GetId()); err != nil {
+		log.Println(err)
+	}
+}
+
+// findManagedRoom returns the target room if the client owns it or is an admin.
+func (client *Client) findManagedRoom(message Message) *Room {
+	if message.Target == nil {
+		return nil
+	}
+
+	room := client.wsServer.findRoomByID(message.Target.GetId())
+	if room == nil {
+		return nil
+	}
+
+	if client.roleIn(room) != models.RoleOwner && !client.isAdmin() {
+		client.sendError(room, "Not allowed to manage this room")
+		return nil
+	}
+
+	return room
+}
+
+func (client *Client) isAdmin() bool {
+	dbUser, err := client.wsServer.userRepository.FindDbUserById(client.GetID())
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	return dbUser != nil && dbUser.GetAdmin()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"log"
+
+	"github.com/nagohak/chat-app/api"
+	"github.com/nagohak/chat-app/dto"
+)
+
+// Maximum number of attachments a single message may reference
+const maxMessageAttachments = 10
+
+const invalidAttachmentMessage = "Invalid attachment"
+
+// prepareAttachments checks the attachments referenced by the message were uploaded by the client
+// and not sent yet, and fills in their details.
+func (client *Client) prepareAttachments(room *Room, message *Message) bool {
+	if len(message.Attachments) > maxMessageAttachments {
+		client.sendError(room, "Too many attachments")
+		return false
+	}
+
+	seen := make(map[string]bool, len(message.Attachments))
+	attachments := make([]*dto.AttachmentInfo, 0, len(message.Attachments))
+	for _, requested := range message.Attachments {
+		if requested == nil || seen[requested.Id] {
+			continue
+		}
+		seen[requested.Id] = true
+
+		attachment, err := client.wsServer.attachmentRepository.FindAttachment(requested.Id)
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+		if attachment == nil || attachment.GetUploaderId() != client.GetID() || attachment.GetRoomId() != "" {
+			client.sendError(room, invalidAttachmentMessage)
+			return false
+		}
+
+		info := dto.NewAttachmentInfo(attachment)
+		attachments = append(attachments, &info)
+	}
+
+	message.Attachments = attachments
+	return true
+}
+
+// storeAttachments binds the attachments of the stored message to it. Attachments another message
+// got hold of in the meantime are dropped from the message.
+func (r *Room) storeAttachments(message *Message) {
+	if len(message.Attachments) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(message.Attachments))
+	for _, attachment := range message.Attachments {
+		ids = append(ids, attachment.Id)
+	}
+
+	attached, err := r.wsServer.attachmentRepository.AttachToMessage(ids, message.Sender.GetID(), r.GetId(), message.ID)
+	if err != nil {
+		log.Println(err)
+	}
+
+	message.Attachments = make([]*dto.AttachmentInfo, 0, len(attached))
+	for _, attachment := range attached {
+		info := dto.NewAttachmentInfo(attachment)
+		message.Attachments = append(message.Attachments, &info)
+	}
+}
+
+// attachAttachments adds the attachments to each of the given messages. Deleted messages
+// keep none, whatever was left of them.
+func (server *WsServer) attachAttachments(messages []*Message) {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		if !message.Deleted {
+			ids = append(ids, message.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	attachments, err := server.attachmentRepository.GetMessageAttachments(ids)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, message := range messages {
+		for _, attachment := range attachments[message.ID] {
+			info := dto.NewAttachmentInfo(attachment)
+			message.Attachments = append(message.Attachments, &info)
+		}
+	}
+}
+
+// deleteMessageAttachments deletes the attachments of a deleted message along with their files.
+func (server *WsServer) deleteMessageAttachments(messageID string) {
+	ids, err := server.attachmentRepository.DeleteMessageAttachments(messageID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	server.deleteAttachmentBlobs(ids)
+}
+
+func (server *WsServer) deleteAttachmentBlobs(ids []string) {
+	for _, id := range ids {
+		if err := server.storage.Delete(api.AttachmentBlobs(id)); err != nil {
+			log.Println(err)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package auth
 
-import "github.com/nagohak/chat-app/models"
+import (
+	"time"
+
+	"github.com/nagohak/chat-app/models"
+)
 
 type Auth interface {
 	GeneratePassword(password string) (string, error)
@@ -8,6 +12,8 @@ type Auth interface {
 	CreateToken(user models.User) (string, error)
 	ValidateToken(tokenString string) (models.User, error)
 	NewUser(id string, name string) models.User
+	CreateInviteToken(inviteID string, roomID string, expiresAt time.Time) (string, error)
+	ValidateInviteToken(tokenString string) (string, string, error)
 }
 
 type auth struct{}
@@ -9,6 +9,9 @@ import (
 )
 
 const secret = "BFJWFwFtQgXL4JGE"
+
+// Invites are signed with their own key so they can never pass as a login token.
+const inviteSecret = secret + ":invite"
 const expireTime = 604800 // one week
 
 type Claims struct {
@@ -50,3 +53,40 @@ func (a *auth) ValidateToken(tokenString string) (models.User, error) {
 
 	return nil, err
 }
+
+type InviteClaims struct {
+	InviteID string `json:"inviteId"`
+	RoomID   string `json:"roomId"`
+	jwt.StandardClaims
+}
+
+// CreateInviteToken signs the invite and room IDs. A zero expiresAt makes a token that does not expire.
+func (a *auth) CreateInviteToken(inviteID string, roomID string, expiresAt time.Time) (string, error) {
+	claims := &InviteClaims{InviteID: inviteID, RoomID: roomID}
+	if !expiresAt.IsZero() {
+		claims.ExpiresAt = expiresAt.Unix()
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(inviteSecret))
+}
+
+// ValidateInviteToken returns the invite and room IDs of a valid, unexpired invite token.
+func (a *auth) ValidateInviteToken(tokenString string) (string, string, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &InviteClaims{}, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+
+		return []byte(inviteSecret), nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if claims, ok := token.Claims.(*InviteClaims); ok && token.Valid && claims.InviteID != "" && claims.RoomID != "" {
+		return claims.InviteID, claims.RoomID, nil
+	}
+
+	return "", "", fmt.Errorf("invalid invite token")
+}
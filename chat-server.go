@@ -3,52 +3,83 @@ package main
 import (
 	"encoding/json"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/nagohak/chat-app/auth"
 	"github.com/nagohak/chat-app/models"
 	"github.com/nagohak/chat-app/pkg/redis"
+	"github.com/nagohak/chat-app/pkg/storage"
 )
 
 const PubSubGeneralChannel = "general"
 
 type WsServer struct {
-	clients        map[*Client]bool
-	register       chan *Client
-	unregister     chan *Client
-	broadcast      chan []byte
-	rooms          map[*Room]bool
-	users          []models.User
-	roomRepository models.RoomRepository
-	userRepository models.UserRepository
-	redis          *redis.Client
+	nodeID               string
+	clients              map[*Client]bool
+	clientsLock          sync.RWMutex
+	register             chan *Client
+	unregister           chan *Client
+	broadcast            chan []byte
+	rooms                map[*Room]bool
+	roomsLock            sync.RWMutex
+	roomIdleTimeout      time.Duration
+	awayAfter            time.Duration
+	roomRepository       models.RoomRepository
+	userRepository       models.UserRepository
+	messageRepository    models.MessageRepository
+	reactionRepository   models.ReactionRepository
+	receiptRepository    models.ReceiptRepository
+	inviteRepository     models.InviteRepository
+	attachmentRepository models.AttachmentRepository
+	storage              storage.Storage
+	redis                *redis.Client
+	auth                 auth.Auth
 }
 
-func NewWsServer(roomRepository models.RoomRepository, userRepository models.UserRepository, redis *redis.Client) *WsServer {
+func NewWsServer(roomRepository models.RoomRepository, userRepository models.UserRepository, messageRepository models.MessageRepository,
+	reactionRepository models.ReactionRepository, receiptRepository models.ReceiptRepository, inviteRepository models.InviteRepository,
+	attachmentRepository models.AttachmentRepository, storage storage.Storage, redis *redis.Client, auth auth.Auth, roomIdleTimeout time.Duration, awayAfter time.Duration) *WsServer {
 	s := &WsServer{
-		clients:        make(map[*Client]bool),
-		register:       make(chan *Client),
-		unregister:     make(chan *Client),
-		broadcast:      make(chan []byte),
-		rooms:          make(map[*Room]bool),
-		roomRepository: roomRepository,
-		userRepository: userRepository,
-		redis:          redis,
+		nodeID:               uuid.New().String(),
+		clients:              make(map[*Client]bool),
+		register:             make(chan *Client),
+		unregister:           make(chan *Client),
+		broadcast:            make(chan []byte),
+		rooms:                make(map[*Room]bool),
+		roomRepository:       roomRepository,
+		userRepository:       userRepository,
+		messageRepository:    messageRepository,
+		reactionRepository:   reactionRepository,
+		receiptRepository:    receiptRepository,
+		inviteRepository:     inviteRepository,
+		attachmentRepository: attachmentRepository,
+		storage:              storage,
+		redis:                redis,
+		auth:                 auth,
+		roomIdleTimeout:      roomIdleTimeout,
+		awayAfter:            awayAfter,
 	}
 
-	users, err := userRepository.GetAllUsers()
-	if err != nil {
-		log.Fatalln(err)
-	}
-	s.users = users
-
 	return s
 }
 
 func (server *WsServer) Run() {
 	go server.listPubSubChannel()
 
+	ticker := time.NewTicker(connectionsReportPeriod)
+	defer ticker.Stop()
+
+	heartbeat := time.NewTicker(presenceHeartbeatPeriod)
+	defer heartbeat.Stop()
+
 	for {
 		select {
+		case <-ticker.C:
+			server.reportConnections()
+		case <-heartbeat.C:
+			server.refreshPresence()
 		case client := <-server.register:
 			server.registerClient(client)
 		case client := <-server.unregister:
@@ -59,64 +90,32 @@ func (server *WsServer) Run() {
 	}
 }
 
-func (server *WsServer) publishClientJoined(client *Client) {
-	message := &Message{
-		Action: UserJoinedAction,
-		Sender: client,
-	}
-
-	if err := server.redis.Publish(ctx, PubSubGeneralChannel, message.encode()).Err(); err != nil {
-		log.Println(err)
-	}
-}
-
-func (server *WsServer) publicClientLeft(client *Client) {
-	message := &Message{
-		Action: UserLeftAction,
-		Sender: client,
-	}
-
-	if err := server.redis.Publish(ctx, PubSubGeneralChannel, message.encode()).Err(); err != nil {
-		log.Println(err)
-	}
-}
-
 func (server *WsServer) listPubSubChannel() {
 	pubsub := server.redis.Subscribe(ctx, PubSubGeneralChannel)
 	ch := pubsub.Channel()
 
-	var message Message
 	for msg := range ch {
+		var message Message
 		if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil {
 			log.Printf("Error on unmarshal JSON message %s\n", err)
-			return
+			continue
 		}
-	}
 
-	switch message.Action {
-	case UserJoinedAction:
-		server.handleUserJoined(message)
-	case UserLeftAction:
-		server.handleUserLeft(message)
-	case JoinRoomPrivateAction:
-		server.handleUserJoinPrivate(message)
-	}
-}
-
-func (server *WsServer) handleUserJoined(message Message) {
-	server.users = append(server.users, message.Sender)
-	server.broadcastToClients(message.encode())
-}
-
-func (server *WsServer) handleUserLeft(message Message) {
-	for i, user := range server.users {
-		if user.GetID() == message.Sender.GetID() {
-			server.users[i] = server.users[len(server.users)-1]
-			server.users = server.users[:len(server.users)-1]
-			break // only remove the first occurence
+		switch message.Action {
+		case PresenceChangedAction:
+			server.handlePresenceChanged(message)
+		case JoinRoomPrivateAction:
+			server.handleUserJoinPrivate(message)
+		case DisconnectUserAction:
+			server.handleDisconnectUser(message)
+		case RoomDeletedAction:
+			server.handleRoomDeleted(message)
+		case RoomArchivedAction, RoomUnarchivedAction:
+			server.handleRoomArchived(message)
+		case JoinRoomAction:
+			server.handleUserJoinRoom(message)
 		}
 	}
-	server.broadcastToClients(message.encode())
 }
 
 func (server *WsServer) handleUserJoinPrivate(message Message) {
@@ -124,24 +123,34 @@ func (server *WsServer) handleUserJoinPrivate(message Message) {
 	// Expect multiple clients for one user now.
 	targetClients := server.findClientsByID(message.Message)
 	for _, client := range targetClients {
-		client.joinRoom(message.Target.GetName(), message.Sender)
+		go client.requestJoin(message.Target.GetName(), message.Sender)
 	}
 }
 
 func (server *WsServer) FindUserById(ID string) models.User {
-	var found models.User
-	for _, user := range server.users {
-		if user.GetID() == ID {
-			found = user
-			break
-		}
+	user, err := server.userRepository.FindUserById(ID)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return user
+}
 
+func (server *WsServer) findRoomByID(ID string) *Room {
+	found := server.findLocalRoomByID(ID)
+
+	if found == nil {
+		found = server.runRoomFromRepository(server.roomRepository.FindRoomById(ID))
 	}
 
 	return found
 }
 
-func (server *WsServer) findRoomByID(ID string) *Room {
+// findLocalRoomByID only looks at the rooms running on this node.
+func (server *WsServer) findLocalRoomByID(ID string) *Room {
+	server.roomsLock.RLock()
+	defer server.roomsLock.RUnlock()
+
 	var found *Room
 	for room := range server.rooms {
 		if room.GetId() == ID {
@@ -153,6 +162,33 @@ func (server *WsServer) findRoomByID(ID string) *Room {
 	return found
 }
 
+// stopRoom stops the room and forgets it on this node.
+func (server *WsServer) stopRoom(room *Room) {
+	server.roomsLock.Lock()
+	delete(server.rooms, room)
+	server.roomsLock.Unlock()
+
+	room.shutdown()
+}
+
+// runRoom starts the room on this node. If the same room is already running, for instance
+// because it was loaded concurrently, the running one is returned instead.
+func (server *WsServer) runRoom(r *Room) *Room {
+	server.roomsLock.Lock()
+	defer server.roomsLock.Unlock()
+
+	for room := range server.rooms {
+		if room.GetId() == r.GetId() {
+			return room
+		}
+	}
+
+	server.rooms[r] = true
+	go r.RunRoom()
+
+	return r
+}
+
 // func (server *WsServer) findClientByID(ID string) *Client {
 // 	var found *Client
 // 	for client := range server.clients {
@@ -165,7 +201,11 @@ func (server *WsServer) findRoomByID(ID string) *Room {
 // 	return found
 // }
 
+// findClientsByID may be called from any goroutine, the clients are only changed by Run.
 func (server *WsServer) findClientsByID(ID string) []*Client {
+	server.clientsLock.RLock()
+	defer server.clientsLock.RUnlock()
+
 	var found []*Client
 	for client := range server.clients {
 		if client.ID.String() == ID {
@@ -176,7 +216,21 @@ func (server *WsServer) findClientsByID(ID string) []*Client {
 	return found
 }
 
+// findRoomByName returns the room running on this node, starting it from the repository if needed.
 func (server *WsServer) findRoomByName(name string) *Room {
+	found := server.findLocalRoomByName(name)
+
+	if found == nil {
+		found = server.runRoomFromRepository(server.roomRepository.FindRoomByName(name))
+	}
+
+	return found
+}
+
+func (server *WsServer) findLocalRoomByName(name string) *Room {
+	server.roomsLock.RLock()
+	defer server.roomsLock.RUnlock()
+
 	var found *Room
 	for room := range server.rooms {
 		if room.GetName() == name {
@@ -185,44 +239,46 @@ func (server *WsServer) findRoomByName(name string) *Room {
 		}
 	}
 
-	if found == nil {
-		found = server.runRoomFromRepository(name)
-	}
-
 	return found
 }
 
-func (server *WsServer) runRoomFromRepository(name string) *Room {
+// runRoomFromRepository runs a room found in the repository, taking the lookup result as is.
+func (server *WsServer) runRoomFromRepository(dbRoom models.Room, err error) *Room {
 	var r *Room
 
-	dbRoom, err := server.roomRepository.FindRoomByName(name)
 	if err != nil {
 		log.Println(err)
 		return nil
 	}
 	if dbRoom != nil {
-		r = NewRoom(dbRoom.GetName(), dbRoom.GetPrivate(), server.redis)
+		r = NewRoom(dbRoom.GetName(), dbRoom.GetPrivate(), server)
 		r.ID, _ = uuid.Parse(dbRoom.GetId())
+		r.Topic = dbRoom.GetTopic()
+		r.Description = dbRoom.GetDescription()
+		r.Archived = dbRoom.GetArchived()
 
-		go r.RunRoom()
-		server.rooms[r] = true
+		r = server.runRoom(r)
 	}
 
 	return r
 }
 
-func (server *WsServer) createRoom(name string, private bool) *Room {
-	r := NewRoom(name, private, server.redis)
+// createRoom creates and runs a new room, recording the owner if there is one.
+func (server *WsServer) createRoom(name string, private bool, owner models.User) *Room {
+	r := NewRoom(name, private, server)
 
 	err := server.roomRepository.AddRoom(r)
 	if err != nil {
 		log.Println(err)
 	}
 
-	go r.RunRoom()
-	server.rooms[r] = true
+	if owner != nil {
+		if err := server.roomRepository.AddRoomMember(r.GetId(), owner.GetID(), models.RoleOwner); err != nil {
+			log.Println(err)
+		}
+	}
 
-	return r
+	return server.runRoom(r)
 }
 
 func (server *WsServer) registerClient(client *Client) {
@@ -233,59 +289,75 @@ func (server *WsServer) registerClient(client *Client) {
 		}
 	}
 
-	server.publishClientJoined(client)
-
-	server.listOnlineClients(client)
+	server.clientsLock.Lock()
 	server.clients[client] = true
-}
+	server.clientsLock.Unlock()
+	server.reportConnections()
 
-func (server *WsServer) unregisterClient(client *Client) {
-	delete(server.clients, client)
+	server.markActive(client.GetID())
+
+	// Presence is counted per user, so only the first connection on this node counts.
+	if len(server.findClientsByID(client.GetID())) == 1 {
+		server.userConnected(client)
+	}
 
-	// err := server.userRepository.RemoveUser(client)
-	// if err != nil {
-	// 	log.Println(err)
-	// }
-	server.publicClientLeft(client)
+	server.sendUsersSummary(client)
 }
 
-func (server *WsServer) broadcastToClients(message []byte) {
-	for client := range server.clients {
-		client.send <- message
-	}
+// startClient sends a new connection its unread counts and direct conversations and puts
+// it back into its member rooms. It runs on the client goroutine, which owns the rooms of
+// the client, so the queries do not hold up other connections either.
+func (server *WsServer) startClient(client *Client) {
+	server.listUnreadCounts(client)
+	server.listDirectRooms(client)
+
+	server.joinMemberRooms(client)
+
+	client.saveSession()
+	client.notifySessionStarted()
 }
 
-// func (server *WsServer) notifiyClientJoined(client *Client) {
-// 	message := &Message{
-// 		Action: UserJoinedAction,
-// 		Sender: client,
-// 	}
+// joinMemberRooms puts the client back into every room the user is a member of.
+func (server *WsServer) joinMemberRooms(client *Client) {
+	dbRooms, err := server.roomRepository.GetUserRooms(client.GetID())
+	if err != nil {
+		log.Println(err)
+		return
+	}
 
-// 	server.broadcastToClients(message.encode())
-// }
+	// Direct conversations are announced with the other participant as sender.
+	peers := make(map[string]models.User)
+	if directRooms, err := server.roomRepository.GetDirectRooms(client.GetID()); err != nil {
+		log.Println(err)
+	} else {
+		for _, directRoom := range directRooms {
+			peers[directRoom.GetId()] = directRoom.GetPeer()
+		}
+	}
 
-// func (server *WsServer) notifiyClientLeft(client *Client) {
-// 	message := &Message{
-// 		Action: UserLeftAction,
-// 		Sender: client,
-// 	}
+	for _, dbRoom := range dbRooms {
+		client.joinRoom(dbRoom.GetName(), peers[dbRoom.GetId()])
+	}
+}
 
-// 	server.broadcastToClients(message.encode())
-// }
+func (server *WsServer) unregisterClient(client *Client) {
+	server.clientsLock.Lock()
+	delete(server.clients, client)
+	server.clientsLock.Unlock()
+	server.reportConnections()
 
-func (server *WsServer) listOnlineClients(client *Client) {
+	lastSeen := time.Now()
+	if err := server.userRepository.SetLastSeen(client.GetID(), lastSeen); err != nil {
+		log.Println(err)
+	}
 
-	// Find unique users istead pf returning all users
-	var uniqueUsers = make(map[string]bool)
+	if len(server.findClientsByID(client.GetID())) == 0 {
+		server.userDisconnected(client, lastSeen)
+	}
+}
 
-	for _, user := range server.users {
-		if ok := uniqueUsers[user.GetID()]; !ok {
-			message := &Message{
-				Action: UserJoinedAction,
-				Sender: user,
-			}
-			uniqueUsers[user.GetID()] = true
-			client.send <- message.encode()
-		}
+func (server *WsServer) broadcastToClients(message []byte) {
+	for client := range server.clients {
+		client.send <- message
 	}
 }
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	ws "github.com/gorilla/websocket"
+	"github.com/nagohak/chat-app/api"
 	"github.com/nagohak/chat-app/auth"
 	"github.com/nagohak/chat-app/models"
 )
@@ -23,7 +25,10 @@ const (
 	pingPeriod = (pongWait * 9) / 10
 
 	// Maximum message size allowed from peer
-	maxMessageSize = 10000
+	maxMessageSize = api.MaxMessageSize
+
+	// Number of messages sent per history page
+	historyPageSize = 50
 )
 
 var upgrader = ws.Upgrader{
@@ -36,23 +41,41 @@ var (
 	// space   = []byte{' '}
 )
 
+// roomJoin asks a client to join a room on its own goroutine.
+type roomJoin struct {
+	roomName string
+	sender   models.User
+}
+
 // Client represents the websocket client at the server
 type Client struct {
 	// The actual websocket connection.
-	conn     *ws.Conn
-	wsServer *WsServer
-	send     chan []byte
-	rooms    map[*Room]bool
-	ID       uuid.UUID `json:"id"`
-	Name     string    `json:"name"`
+	conn        *ws.Conn
+	wsServer    *WsServer
+	send        chan []byte
+	joins       chan roomJoin
+	evictions   chan *Room
+	done        chan struct{}
+	rooms       map[*Room]bool
+	typing      map[*Room]*typingState
+	resumeToken string
+	activeAt    time.Time
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
 }
 
 func newClient(conn *ws.Conn, wsServer *WsServer, ID string, name string) *Client {
 	client := &Client{
-		conn:     conn,
-		wsServer: wsServer,
-		rooms:    make(map[*Room]bool),
-		send:     make(chan []byte, 256),
+		conn:        conn,
+		wsServer:    wsServer,
+		rooms:       make(map[*Room]bool),
+		typing:      make(map[*Room]*typingState),
+		send:        make(chan []byte, 256),
+		joins:       make(chan roomJoin),
+		evictions:   make(chan *Room),
+		done:        make(chan struct{}),
+		resumeToken: uuid.New().String(),
+		activeAt:    time.Now(),
 		// ID:       uuid.New(),
 		Name: name,
 	}
@@ -103,10 +126,13 @@ func (client *Client) GetName() string {
 }
 
 func (client *Client) disconnect() {
+	close(client.done)
 	client.wsServer.unregister <- client
 	for r := range client.rooms {
-		r.unregister <- client
+		client.stopTyping(r)
+		r.leave(client)
 	}
+	client.expireSession()
 	close(client.send)
 	client.conn.Close()
 }
@@ -119,12 +145,34 @@ func (client *Client) handleNewMessage(jsonMessage []byte) {
 	}
 
 	message.Sender = client
+	client.touch()
 
 	switch message.Action {
 	case SendMessageAction:
+		if message.Target == nil {
+			return
+		}
 		roomID := message.Target.GetId()
 		if room := client.wsServer.findRoomByID(roomID); room != nil {
-			room.broadcast <- &message
+			if room.GetArchived() {
+				client.sendError(room, archivedMessage)
+				return
+			}
+			if !client.can(room, PostPermission) {
+				return
+			}
+			if client.isMuted(room) {
+				client.sendError(room, mutedMessage)
+				return
+			}
+			if message.ReplyTo != "" && !client.prepareReply(room, &message) {
+				return
+			}
+			if len(message.Attachments) > 0 && !client.prepareAttachments(room, &message) {
+				return
+			}
+			client.stopTyping(room)
+			room.post(&message)
 		}
 	case JoinRoomAction:
 		client.handleJoinRoomMessage(message)
@@ -132,56 +180,292 @@ func (client *Client) handleNewMessage(jsonMessage []byte) {
 		client.handleLeaveRoomMessage(message)
 	case JoinRoomPrivateAction:
 		client.handleJoinRoomPrivateMessage(message)
+	case FetchHistoryAction:
+		client.handleFetchHistoryMessage(message)
+	case ResumeAction:
+		client.handleResumeMessage(message)
+	case EditMessageAction:
+		client.handleEditMessage(message)
+	case DeleteMessageAction:
+		client.handleDeleteMessage(message)
+	case FetchThreadAction:
+		client.handleFetchThreadMessage(message)
+	case UnsubscribeThreadAction:
+		client.handleUnsubscribeThreadMessage(message)
+	case AddReactionAction, RemoveReactionAction:
+		client.handleReactionMessage(message)
+	case TypingStartAction, TypingStopAction:
+		client.handleTypingMessage(message)
+	case MarkReadAction:
+		client.handleMarkReadMessage(message)
+	case FetchReceiptsAction:
+		client.handleFetchReceiptsMessage(message)
+	case CreateGroupAction:
+		client.handleCreateGroupMessage(message)
+	case AddMemberAction:
+		client.handleAddMemberMessage(message)
+	case RemoveMemberAction:
+		client.handleRemoveMemberMessage(message)
+	case SetRoleAction:
+		client.handleSetRoleMessage(message)
+	case KickUserAction, BanUserAction, UnbanUserAction, MuteUserAction, UnmuteUserAction:
+		client.handleModerationMessage(message)
+	case ListRoomsAction:
+		client.handleListRoomsMessage(message)
+	case UpdateRoomAction:
+		client.handleUpdateRoomMessage(message)
+	case ArchiveRoomAction, UnarchiveRoomAction:
+		client.handleArchiveRoomMessage(message)
+	case DeleteRoomAction:
+		client.handleDeleteRoomMessage(message)
+	case CreateInviteAction:
+		client.handleCreateInviteMessage(message)
+	case RedeemInviteAction:
+		client.handleRedeemInviteMessage(message)
+	case SetStatusAction:
+		client.handleSetStatusMessage(message)
+	case SearchUsersAction:
+		client.handleSearchUsersMessage(message)
 	}
 }
 
 func (client *Client) handleJoinRoomMessage(message Message) {
 	roomName := message.Message
 
+	// The membership is added first so that room-joined carries the role. New rooms are
+	// created by joinRoom with the client as owner.
+	if room := client.wsServer.findRoomByName(roomName); room != nil {
+		if !room.allowsClient(client) {
+			return
+		}
+
+		if err := client.wsServer.roomRepository.AddRoomMember(room.GetId(), client.GetID(), models.RoleMember); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+
 	client.joinRoom(roomName, nil)
 }
 
+// handleLeaveRoomMessage is the only way for a user to drop the room membership.
 func (client *Client) handleLeaveRoomMessage(message Message) {
 	room := client.wsServer.findRoomByID(message.Message)
 	if room == nil {
 		return
 	}
 
-	delete(client.rooms, room)
+	if err := client.wsServer.roomRepository.RemoveRoomMember(room.GetId(), client.GetID()); err != nil {
+		log.Println(err)
+	}
 
-	room.unregister <- client
+	client.leaveRoom(room)
+}
+
+// leaveRoom removes the client from the room without touching the membership.
+func (client *Client) leaveRoom(room *Room) {
+	client.dropRoom(room)
+	room.leave(client)
+}
+
+// requestJoin makes the client join the room on its own goroutine, for joins that
+// arrive through the pub/sub channel.
+func (client *Client) requestJoin(roomName string, sender models.User) {
+	select {
+	case client.joins <- roomJoin{roomName: roomName, sender: sender}:
+	case <-client.done:
+	}
+}
+
+// evict tells the client it was removed from the room by RunRoom.
+func (client *Client) evict(room *Room) {
+	select {
+	case client.evictions <- room:
+	case <-client.done:
+	}
+}
+
+// dropRoom forgets the room on the client side only.
+func (client *Client) dropRoom(room *Room) {
+	client.stopTyping(room)
+	delete(client.typing, room)
+	delete(client.rooms, room)
+	client.saveSession()
 }
 
 func (client *Client) handleJoinRoomPrivateMessage(message Message) {
 	target := client.wsServer.FindUserById(message.Message)
-	if target == nil {
+	if target == nil || target.GetID() == client.GetID() {
 		return
 	}
 
-	roomName := message.Message + client.GetID()
+	room := client.wsServer.findDirectRoom(client, target)
+	if room == nil {
+		return
+	}
 
-	joinedRoom := client.joinRoom(roomName, target)
+	joinedRoom := client.joinRoom(room.GetName(), target)
 
 	if joinedRoom != nil {
 		client.inviteTargetUser(target, joinedRoom)
 	}
 }
 
+func (client *Client) handleFetchHistoryMessage(message Message) {
+	if message.Target == nil {
+		return
+	}
+
+	room := client.wsServer.findRoomByID(message.Target.GetId())
+	if room == nil || !client.isInRoom(room) {
+		return
+	}
+
+	// The cursor is the sequence number of the oldest message the client already has.
+	var beforeSeq int64
+	if message.Message != "" {
+		var err error
+		if beforeSeq, err = strconv.ParseInt(message.Message, 10, 64); err != nil {
+			log.Printf("Invalid history cursor: %s\n", err)
+			return
+		}
+	}
+
+	client.sendRoomHistory(room, beforeSeq)
+}
+
+func (client *Client) handleEditMessage(message Message) {
+	room, dbMessage := client.findOwnMessage(message)
+	if dbMessage == nil || dbMessage.GetDeleted() {
+		return
+	}
+
+	if client.isMuted(room) {
+		client.sendError(room, mutedMessage)
+		return
+	}
+
+	editedAt := time.Now().UTC()
+	if err := client.wsServer.messageRepository.EditMessage(dbMessage.GetId(), message.Message, editedAt); err != nil {
+		log.Println(err)
+		return
+	}
+
+	room.publishRoomMessage(&Message{
+		ID:       dbMessage.GetId(),
+		Action:   MessageEditedAction,
+		Message:  message.Message,
+		Target:   room,
+		Sender:   client,
+		Seq:      dbMessage.GetSeq(),
+		EditedAt: &editedAt,
+		ReplyTo:  dbMessage.GetReplyTo(),
+	})
+}
+
+func (client *Client) handleDeleteMessage(message Message) {
+	room, dbMessage := client.findOwnMessage(message)
+	if dbMessage == nil || dbMessage.GetDeleted() {
+		return
+	}
+
+	if err := client.wsServer.messageRepository.DeleteMessage(dbMessage.GetId(), time.Now().UTC()); err != nil {
+		log.Println(err)
+		return
+	}
+
+	client.wsServer.deleteMessageAttachments(dbMessage.GetId())
+
+	room.publishRoomMessage(&Message{
+		ID:      dbMessage.GetId(),
+		Action:  MessageDeletedAction,
+		Target:  room,
+		Sender:  client,
+		Seq:     dbMessage.GetSeq(),
+		Deleted: true,
+		ReplyTo: dbMessage.GetReplyTo(),
+	})
+}
+
+// findOwnMessage looks up the stored message referenced by message.ID in the target room,
+// returning nil if the client is neither its sender nor allowed to moderate the room.
+func (client *Client) findOwnMessage(message Message) (*Room, models.Message) {
+	room, dbMessage := client.findRoomMessage(message)
+	if dbMessage == nil {
+		return nil, nil
+	}
+
+	if room.GetArchived() {
+		return nil, nil
+	}
+
+	if dbMessage.GetSender().GetID() != client.GetID() && !client.can(room, ModerateMessagesPermission) {
+		return nil, nil
+	}
+
+	return room, dbMessage
+}
+
+// findRoomMessage looks up the stored message referenced by message.ID in the target room,
+// returning nil if the client is not a member of that room.
+func (client *Client) findRoomMessage(message Message) (*Room, models.Message) {
+	if message.Target == nil || message.ID == "" {
+		return nil, nil
+	}
+
+	room := client.wsServer.findRoomByID(message.Target.GetId())
+	if room == nil || !client.isInRoom(room) {
+		return nil, nil
+	}
+
+	dbMessage, err := client.wsServer.messageRepository.FindMessageById(message.ID)
+	if err != nil {
+		log.Println(err)
+		return nil, nil
+	}
+
+	if dbMessage == nil || dbMessage.GetRoomId() != room.GetId() {
+		return nil, nil
+	}
+
+	return room, dbMessage
+}
+
 func (client *Client) joinRoom(roomName string, sender models.User) *Room {
 	room := client.wsServer.findRoomByName(roomName)
 	if room == nil {
-		room = client.wsServer.createRoom(roomName, sender != nil)
+		if reason := checkNewRoomName(roomName); reason != "" {
+			client.sendError(nil, reason)
+			return nil
+		}
+		room = client.wsServer.createRoom(roomName, sender != nil, client)
 	}
 
-	if sender == nil && room.Private {
+	if !room.allowsClient(client) {
 		return nil
 	}
 
 	if !client.isInRoom(room) {
+		if room = client.enterRoom(room); room == nil {
+			return nil
+		}
 		client.rooms[room] = true
-		room.register <- client
+		client.saveSession()
 
 		client.notifyRoomJoined(room, sender)
+		client.sendRoomHistory(room, 0)
+	}
+
+	return room
+}
+
+// enterRoom registers the client in the room. A room that stopped in the meantime is
+// looked up again, which starts it anew unless it was deleted.
+func (client *Client) enterRoom(room *Room) *Room {
+	for !room.join(client) {
+		if room = client.wsServer.findRoomByID(room.GetId()); room == nil {
+			return nil
+		}
 	}
 
 	return room
@@ -213,6 +497,45 @@ func (client *Client) notifyRoomJoined(room *Room, sender models.User) {
 		Action: RoomJoinedAction,
 		Target: room,
 		Sender: sender,
+		Unread: map[string]int{room.GetId(): client.unreadCount(room)},
+		Role:   client.roleIn(room),
+	}
+
+	client.send <- message.encode()
+}
+
+func (client *Client) sendRoomHistory(room *Room, beforeSeq int64) {
+	dbMessages, err := client.wsServer.messageRepository.GetRoomMessages(room.GetId(), beforeSeq, historyPageSize)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	message := &Message{
+		Action:  FetchHistoryAction,
+		Target:  room,
+		History: make([]*Message, 0, len(dbMessages)),
+	}
+
+	for _, dbMessage := range dbMessages {
+		message.History = append(message.History, newMessageFromModel(room, dbMessage))
+	}
+	client.wsServer.attachReactions(message.History)
+	client.wsServer.attachAttachments(message.History)
+
+	// Cursor for the next page, empty when there is nothing older left.
+	if len(dbMessages) == historyPageSize {
+		message.Message = strconv.FormatInt(dbMessages[0].GetSeq(), 10)
+	}
+
+	client.send <- message.encode()
+}
+
+func (client *Client) sendError(room *Room, text string) {
+	message := &Message{
+		Action:  ErrorAction,
+		Message: text,
+		Target:  room,
 	}
 
 	client.send <- message.encode()
@@ -227,19 +550,42 @@ func (client *Client) readPump() {
 	client.conn.SetReadDeadline(time.Now().Add(pongWait))
 	client.conn.SetPongHandler(func(string) error { client.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
+	incoming := make(chan []byte)
+	go client.readMessages(incoming)
+
+	client.wsServer.startClient(client)
+
+	// The rooms of the client are only changed here, so they need no locking.
+	for {
+		select {
+		case jsonMessage, ok := <-incoming:
+			if !ok {
+				return
+			}
+			client.handleNewMessage(jsonMessage)
+		case join := <-client.joins:
+			client.joinRoom(join.roomName, join.sender)
+		case room := <-client.evictions:
+			client.dropRoom(room)
+		}
+	}
+}
+
+// readMessages passes the messages read from the connection on until reading fails.
+func (client *Client) readMessages(incoming chan<- []byte) {
+	defer close(incoming)
+
 	for {
 		_, jsonMessage, err := client.conn.ReadMessage()
 		if err != nil {
 			if ws.IsUnexpectedCloseError(err, ws.CloseGoingAway, ws.CloseAbnormalClosure) {
 				log.Printf("unexpected close error: %v\n", err)
 			}
-			break
-
+			return
 		}
 
-		client.handleNewMessage(jsonMessage)
+		incoming <- jsonMessage
 	}
-
 }
 
 func (client *Client) writePump() {
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
@@ -11,6 +12,8 @@ type (
 		Http     `yaml:"http"`
 		Redis    `yaml:"redis"`
 		Postgres `yaml:"postgres"`
+		Chat     `yaml:"chat"`
+		Storage  `yaml:"storage"`
 	}
 	Http struct {
 		Port string `env-required:"true" yaml:"port" env:"HTTP_PORT"`
@@ -26,6 +29,16 @@ type (
 		User     string `env-required:"true" yaml:"user" env:"POSTGRES_USER"`
 		Password string `env-required:"true" yaml:"password" env:"POSTGRES_PASSWORD"`
 	}
+	Chat struct {
+		// Rooms without local clients are stopped after this long, zero keeps them running
+		RoomIdleTimeout time.Duration `yaml:"room_idle_timeout" env:"CHAT_ROOM_IDLE_TIMEOUT" env-default:"10m"`
+		// Users without activity are shown as away after this long
+		AwayAfter time.Duration `yaml:"away_after" env:"CHAT_AWAY_AFTER" env-default:"5m"`
+	}
+	Storage struct {
+		// Uploaded files are stored below this directory
+		Dir string `yaml:"dir" env:"STORAGE_DIR" env-default:"./uploads"`
+	}
 )
 
 func NewConfig() (*Config, error) {
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/nagohak/chat-app/models"
+)
+
+const directRoomPrefix = "dm:"
+
+// directRoomName is the same for both users of the conversation.
+func directRoomName(userA models.User, userB models.User) string {
+	a, b := userA.GetID(), userB.GetID()
+	if a > b {
+		a, b = b, a
+	}
+	return directRoomPrefix + a + ":" + b
+}
+
+// findDirectRoom returns the conversation between the two users, creating it on first use.
+func (server *WsServer) findDirectRoom(userA models.User, userB models.User) *Room {
+	dbRoom, err := server.roomRepository.FindDirectRoom(userA.GetID(), userB.GetID())
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	var room *Room
+	if dbRoom != nil {
+		if room = server.findRoomByID(dbRoom.GetId()); room == nil {
+			return nil
+		}
+	} else {
+		name := directRoomName(userA, userB)
+		if room = server.findRoomByName(name); room == nil {
+			room = server.createRoom(name, true, nil)
+		} else if !server.unclaimedDirectRoom(room, userA, userB) {
+			// Someone else got hold of the name, the conversation gets a room of its own.
+			room = server.createRoom(name+":"+uuid.New().String(), true, nil)
+		}
+
+		if err := server.roomRepository.AddDirectRoom(room.GetId(), userA.GetID(), userB.GetID()); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// Leaving a conversation drops the membership, opening it again restores it.
+	for _, user := range []models.User{userA, userB} {
+		if err := server.roomRepository.AddRoomMember(room.GetId(), user.GetID(), models.RoleMember); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return room
+}
+
+// unclaimedDirectRoom reports whether the room found under the name of the conversation
+// can be taken over: it has to be private and have no members but the two users.
+func (server *WsServer) unclaimedDirectRoom(room *Room, userA models.User, userB models.User) bool {
+	if !room.Private {
+		return false
+	}
+
+	members, err := server.roomRepository.GetRoomMemberIds(room.GetId())
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	for _, member := range members {
+		if member != userA.GetID() && member != userB.GetID() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// listDirectRooms sends the client one frame per direct conversation of the user,
+// with the other participant as sender.
+func (server *WsServer) listDirectRooms(client *Client) {
+	dbRooms, err := server.roomRepository.GetDirectRooms(client.GetID())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, dbRoom := range dbRooms {
+		room := server.findRoomByID(dbRoom.GetId())
+		if room == nil {
+			continue
+		}
+
+		message := &Message{
+			Action: DirectRoomAction,
+			Target: room,
+			Sender: dbRoom.GetPeer(),
+		}
+		client.send <- message.encode()
+	}
+}
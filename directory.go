@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log"
+
+	"github.com/nagohak/chat-app/dto"
+)
+
+const directoryPageSize = 50
+
+// handleListRoomsMessage sends a page of public rooms whose name starts with message.Message,
+// starting at message.Offset.
+func (client *Client) handleListRoomsMessage(message Message) {
+	if message.Offset < 0 {
+		message.Offset = 0
+	}
+
+	dbRooms, err := client.wsServer.roomRepository.ListPublicRooms(message.Message, directoryPageSize, message.Offset)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	reply := &Message{
+		Action:  ListRoomsAction,
+		Message: message.Message,
+		Offset:  message.Offset,
+		Rooms:   dto.NewRoomListings(dbRooms),
+	}
+
+	client.send <- reply.encode()
+}
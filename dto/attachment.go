@@ -0,0 +1,29 @@
+package dto
+
+import "github.com/nagohak/chat-app/models"
+
+type AttachmentInfo struct {
+	Id           string `json:"id"`
+	Name         string `json:"name,omitempty"`
+	MimeType     string `json:"mimeType,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	Url          string `json:"url,omitempty"`
+	ThumbnailUrl string `json:"thumbnailUrl,omitempty"`
+}
+
+// NewAttachmentInfo describes the attachment with the URLs to download it from.
+func NewAttachmentInfo(attachment models.Attachment) AttachmentInfo {
+	info := AttachmentInfo{
+		Id:       attachment.GetId(),
+		Name:     attachment.GetName(),
+		MimeType: attachment.GetMimeType(),
+		Size:     attachment.GetSize(),
+		Url:      "/api/attachments/" + attachment.GetId(),
+	}
+
+	if attachment.GetThumbnail() {
+		info.ThumbnailUrl = info.Url + "/thumbnail"
+	}
+
+	return info
+}
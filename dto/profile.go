@@ -0,0 +1,47 @@
+package dto
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/nagohak/chat-app/models"
+)
+
+// AvatarSizes are the sizes in pixels avatars are stored and served in.
+var AvatarSizes = []int{64, 256}
+
+type ProfileInfo struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	Timezone    string `json:"timezone,omitempty"`
+	// Avatar maps the avatar sizes to the URLs of the images
+	Avatar map[string]string `json:"avatar,omitempty"`
+}
+
+// NewProfileInfo returns the public profile of the user.
+func NewProfileInfo(user models.User, profile models.Profile) ProfileInfo {
+	return ProfileInfo{
+		Id:          user.GetID(),
+		Name:        user.GetName(),
+		DisplayName: profile.GetDisplayName(),
+		Bio:         profile.GetBio(),
+		Timezone:    profile.GetTimezone(),
+		Avatar:      AvatarURLs(profile.GetAvatar()),
+	}
+}
+
+// AvatarURLs maps the avatar sizes to the URLs of the avatar, it is nil for users without one.
+func AvatarURLs(avatar string) map[string]string {
+	if avatar == "" {
+		return nil
+	}
+
+	urls := make(map[string]string, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		urls[strconv.Itoa(size)] = fmt.Sprintf("/api/avatars/%s/%d.png", avatar, size)
+	}
+
+	return urls
+}
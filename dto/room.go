@@ -0,0 +1,35 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/nagohak/chat-app/models"
+)
+
+// RoomListing is a public room as shown in the room directory.
+type RoomListing struct {
+	Id           string     `json:"id"`
+	Name         string     `json:"name"`
+	Topic        string     `json:"topic,omitempty"`
+	MemberCount  int        `json:"memberCount"`
+	LastActivity *time.Time `json:"lastActivity,omitempty"`
+}
+
+// NewRoomListings returns the directory entries of the rooms.
+func NewRoomListings(dbRooms []models.RoomSummary) []RoomListing {
+	rooms := make([]RoomListing, 0, len(dbRooms))
+	for _, dbRoom := range dbRooms {
+		listing := RoomListing{
+			Id:          dbRoom.GetId(),
+			Name:        dbRoom.GetName(),
+			Topic:       dbRoom.GetTopic(),
+			MemberCount: dbRoom.GetMemberCount(),
+		}
+		if lastActivity := dbRoom.GetLastActivity(); !lastActivity.IsZero() {
+			listing.LastActivity = &lastActivity
+		}
+		rooms = append(rooms, listing)
+	}
+
+	return rooms
+}
@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/nagohak/chat-app/models"
+)
+
+// UserListing is a user as shown in the user directory.
+type UserListing struct {
+	Id          string     `json:"id"`
+	Name        string     `json:"name"`
+	DisplayName string     `json:"displayName,omitempty"`
+	Status      string     `json:"status"`
+	StatusText  string     `json:"statusText,omitempty"`
+	StatusEmoji string     `json:"statusEmoji,omitempty"`
+	LastSeen    *time.Time `json:"lastSeen,omitempty"`
+	// Avatar maps the avatar sizes to the URLs of the images
+	Avatar map[string]string `json:"avatar,omitempty"`
+}
+
+// NewUserListings returns the directory entries of the users.
+func NewUserListings(users []models.UserSummary) []UserListing {
+	listings := make([]UserListing, 0, len(users))
+	for _, user := range users {
+		listing := UserListing{
+			Id:          user.GetID(),
+			Name:        user.GetName(),
+			DisplayName: user.GetDisplayName(),
+			Status:      user.GetStatus(),
+			StatusText:  user.GetStatusText(),
+			StatusEmoji: user.GetStatusEmoji(),
+			Avatar:      AvatarURLs(user.GetAvatar()),
+		}
+		if lastSeen := user.GetLastSeen(); !lastSeen.IsZero() {
+			listing.LastSeen = &lastSeen
+		}
+		listings = append(listings, listing)
+	}
+
+	return listings
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nagohak/chat-app/models"
+)
+
+const groupRoomPrefix = "group:"
+
+// handleCreateGroupMessage creates a private room for the client and the users listed in
+// message.Members and invites everyone to it.
+func (client *Client) handleCreateGroupMessage(message Message) {
+	server := client.wsServer
+
+	members := []models.User{client}
+	seen := map[string]bool{client.GetID(): true}
+	for _, userID := range message.Members {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		if user := server.FindUserById(userID); user != nil {
+			members = append(members, user)
+		}
+	}
+
+	// Two users are a direct conversation, not a group.
+	if len(members) < 3 {
+		return
+	}
+
+	ids := make([]string, 0, len(members)-1)
+	for _, member := range members[1:] {
+		ids = append(ids, member.GetID())
+	}
+
+	// A group that cannot get all its members is not kept around half populated.
+	room := server.createRoom(groupRoomPrefix+uuid.New().String(), true, client)
+	if err := server.roomRepository.AddRoomMembers(room.GetId(), ids, models.RoleMember); err != nil {
+		log.Println(err)
+		if err := server.DeleteRoom(room.GetId()); err != nil {
+			log.Println(err)
+		}
+		client.sendError(nil, "Could not create the group")
+		return
+	}
+
+	client.joinRoom(room.GetName(), client)
+
+	for _, member := range members[1:] {
+		client.inviteTargetUser(member, room)
+	}
+}
+
+func (client *Client) handleAddMemberMessage(message Message) {
+	room := client.findGroupRoom(message)
+	if room == nil || !client.can(room, InvitePermission) {
+		return
+	}
+
+	target := client.wsServer.FindUserById(message.Message)
+	if target == nil {
+		return
+	}
+
+	if err := client.wsServer.roomRepository.AddRoomMember(room.GetId(), target.GetID(), models.RoleMember); err != nil {
+		log.Println(err)
+		return
+	}
+
+	room.publishRoomMessage(&Message{
+		Action:  MemberAddedAction,
+		Message: target.GetID(),
+		Target:  room,
+		Sender:  client,
+	})
+
+	client.inviteTargetUser(target, room)
+}
+
+// handleRemoveMemberMessage removes a member from the group; members may always remove themselves,
+// others only members of a lower role.
+func (client *Client) handleRemoveMemberMessage(message Message) {
+	room := client.findGroupRoom(message)
+	if room == nil || message.Message == "" {
+		return
+	}
+
+	if message.Message != client.GetID() && (!client.can(room, KickPermission) || !client.outranks(room, message.Message)) {
+		client.sendError(room, "Not allowed to remove this member")
+		return
+	}
+
+	if err := client.wsServer.roomRepository.RemoveRoomMember(room.GetId(), message.Message); err != nil {
+		log.Println(err)
+		return
+	}
+
+	room.publishRoomMessage(&Message{
+		Action:  MemberRemovedAction,
+		Message: message.Message,
+		Target:  room,
+		Sender:  client,
+	})
+}
+
+// findGroupRoom returns the group room targeted by the message if the client is in it.
+func (client *Client) findGroupRoom(message Message) *Room {
+	if message.Target == nil {
+		return nil
+	}
+
+	room := client.wsServer.findRoomByID(message.Target.GetId())
+	if room == nil || !room.isGroup() || !client.isInRoom(room) {
+		return nil
+	}
+
+	return room
+}
+
+func (r *Room) isGroup() bool {
+	return r.Private && !strings.HasPrefix(r.GetName(), directRoomPrefix)
+}
+
+// evictUser removes every local client of the user from the room. The clients forget
+// the room on their own goroutine.
+func (r *Room) evictUser(userID string) {
+	for client := range r.clients {
+		if client.GetID() == userID {
+			r.unregisterClientInRoom(client)
+			go client.evict(r)
+		}
+	}
+}
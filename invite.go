@@ -0,0 +1,180 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nagohak/chat-app/api"
+	"github.com/nagohak/chat-app/models"
+)
+
+// CreateInvite mints an invite token for the room that joins users with the given role.
+// The invite can be used maxUses times, zero meaning no limit, and is valid for ttl,
+// zero meaning forever.
+func (server *WsServer) CreateInvite(roomID string, creator models.User, role string, maxUses int, ttl time.Duration) (string, error) {
+	role = inviteRole(role)
+	if (role != models.RoleMember && role != models.RoleModerator) || maxUses < 0 || ttl < 0 {
+		return "", api.ErrInvalid
+	}
+
+	room := server.findRoomByID(roomID)
+	if room == nil {
+		return "", api.ErrNotFound
+	}
+
+	if !server.can(room, creator.GetID(), CreateInviteLinkPermission) {
+		return "", api.ErrForbidden
+	}
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	inviteID := uuid.New().String()
+	if err := server.inviteRepository.AddInvite(inviteID, room.GetId(), creator.GetID(), role, maxUses, expiresAt); err != nil {
+		return "", err
+	}
+
+	return server.auth.CreateInviteToken(inviteID, room.GetId(), expiresAt)
+}
+
+// RedeemInvite makes the user a member of the room the invite is for and joins the
+// user's clients on every node. Members redeeming an invite do not use it up.
+func (server *WsServer) RedeemInvite(token string, user models.User) (models.Room, error) {
+	inviteID, roomID, err := server.auth.ValidateInviteToken(token)
+	if err != nil {
+		return nil, api.ErrForbidden
+	}
+
+	room := server.findRoomByID(roomID)
+	if room == nil {
+		return nil, api.ErrNotFound
+	}
+
+	banned, _, err := server.roomRepository.GetSanction(room.GetId(), user.GetID(), models.SanctionBan)
+	if err != nil {
+		return nil, err
+	}
+	if banned || room.GetArchived() {
+		return nil, api.ErrForbidden
+	}
+
+	member, err := server.roomRepository.IsRoomMember(room.GetId(), user.GetID())
+	if err != nil {
+		return nil, err
+	}
+
+	if !member {
+		invite, err := server.inviteRepository.UseInvite(inviteID)
+		if err != nil {
+			return nil, err
+		}
+		if invite == nil || invite.GetRoomId() != room.GetId() {
+			return nil, api.ErrForbidden
+		}
+
+		if err := server.roomRepository.AddRoomMember(room.GetId(), user.GetID(), invite.GetRole()); err != nil {
+			return nil, err
+		}
+
+		room.publishRoomMessage(&Message{
+			Action:  MemberAddedAction,
+			Message: user.GetID(),
+			Target:  room,
+			Sender:  user,
+		})
+	}
+
+	server.joinUserClients(room, user)
+
+	return room, nil
+}
+
+// joinUserClients joins the clients of the user on every node to the room.
+func (server *WsServer) joinUserClients(room *Room, user models.User) {
+	message := &Message{
+		Action: JoinRoomAction,
+		Target: room,
+		Sender: user,
+	}
+
+	if err := server.redis.Publish(ctx, PubSubGeneralChannel, message.encode()).Err(); err != nil {
+		log.Println(err)
+	}
+}
+
+// handleUserJoinRoom joins every local client of the sender to the target room.
+func (server *WsServer) handleUserJoinRoom(message Message) {
+	if message.Target == nil {
+		return
+	}
+
+	room := server.findRoomByID(message.Target.GetId())
+	if room == nil {
+		return
+	}
+
+	for _, client := range server.findClientsByID(message.Sender.GetID()) {
+		go client.requestJoin(room.GetName(), nil)
+	}
+}
+
+func (client *Client) handleCreateInviteMessage(message Message) {
+	if message.Target == nil {
+		return
+	}
+
+	ttl := time.Duration(message.Duration) * time.Second
+
+	token, err := client.wsServer.CreateInvite(message.Target.GetId(), client, message.Role, message.MaxUses, ttl)
+	if err == api.ErrForbidden {
+		client.sendError(nil, "Not allowed to create invites for this room")
+		return
+	}
+	if err != nil {
+		client.sendError(nil, inviteErrorText(err))
+		return
+	}
+
+	reply := &Message{
+		Action:  InviteCreatedAction,
+		Message: token,
+		Target:  message.Target,
+		Role:    inviteRole(message.Role),
+	}
+
+	client.send <- reply.encode()
+}
+
+// handleRedeemInviteMessage redeems the invite token in message.Message. The client is
+// joined to the room once the membership reaches this node.
+func (client *Client) handleRedeemInviteMessage(message Message) {
+	if _, err := client.wsServer.RedeemInvite(message.Message, client); err != nil {
+		client.sendError(nil, inviteErrorText(err))
+	}
+}
+
+// inviteRole is the role an invite grants, members unless asked otherwise.
+func inviteRole(role string) string {
+	if role == "" {
+		return models.RoleMember
+	}
+
+	return role
+}
+
+func inviteErrorText(err error) string {
+	switch err {
+	case api.ErrInvalid:
+		return "Invalid invite"
+	case api.ErrNotFound:
+		return "Room not found"
+	case api.ErrForbidden:
+		return "Invite is invalid, expired or used up"
+	default:
+		log.Println(err)
+		return "Could not process the invite"
+	}
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"log"
 	"net/http"
+	// The image has no zoneinfo, profiles need it to validate timezones.
+	_ "time/tzdata"
 
 	"github.com/nagohak/chat-app/api"
 	"github.com/nagohak/chat-app/auth"
 	"github.com/nagohak/chat-app/config"
 	"github.com/nagohak/chat-app/pkg/postgres"
 	"github.com/nagohak/chat-app/pkg/redis"
+	"github.com/nagohak/chat-app/pkg/storage"
 	"github.com/nagohak/chat-app/repository"
 )
 
@@ -41,14 +44,30 @@ func main() {
 		log.Fatalf("Can't initialize redis: %s", err)
 	}
 
+	blobs, err := storage.NewLocal(cfg.Storage.Dir)
+	if err != nil {
+		log.Fatalf("Can't initialize storage: %s", err)
+	}
+
 	fs := http.FileServer(http.Dir("./public"))
 
 	userRepository := repository.NewUserRepository(db)
 	roomRepository := repository.NewRoomRepository(db)
+	messageRepository := repository.NewMessageRepository(db)
+	reactionRepository := repository.NewReactionRepository(db)
+	receiptRepository := repository.NewReceiptRepository(db)
+	inviteRepository := repository.NewInviteRepository(db)
+	attachmentRepository := repository.NewAttachmentRepository(db)
 
-	ws := NewWsServer(roomRepository, userRepository, redis)
+	ws := NewWsServer(roomRepository, userRepository, messageRepository, reactionRepository, receiptRepository, inviteRepository,
+		attachmentRepository, blobs, redis, auth, cfg.Chat.RoomIdleTimeout, cfg.Chat.AwayAfter)
 	go ws.Run()
 
+	adminApi := api.NewAdminApi(userRepository, roomRepository, ws, auth)
+	roomApi := api.NewRoomApi(roomRepository, messageRepository, attachmentRepository, ws, auth)
+	userApi := api.NewUserApi(ws)
+	profileApi := api.NewProfileApi(userRepository, blobs, ws)
+	attachmentApi := api.NewAttachmentApi(attachmentRepository, roomRepository, messageRepository, blobs)
 	api := api.NewApi(userRepository, auth)
 
 	http.Handle("/", fs)
@@ -57,6 +76,24 @@ func main() {
 	}))
 	http.HandleFunc("/api/login", api.Login)
 	http.HandleFunc("/api/registration", api.Registration)
+	http.HandleFunc("/api/rooms", api.TokenMiddleware(roomApi.Rooms))
+	http.HandleFunc("/api/rooms/directory", api.TokenMiddleware(roomApi.Directory))
+	http.HandleFunc("/api/rooms/", api.TokenMiddleware(roomApi.RoomResources))
+	http.HandleFunc("/api/invites/redeem", api.TokenMiddleware(roomApi.RedeemInvite))
+	http.HandleFunc("/api/users", api.TokenMiddleware(userApi.Users))
+	http.HandleFunc("/api/users/", api.TokenMiddleware(profileApi.UserProfile))
+	http.HandleFunc("/api/profile", api.TokenMiddleware(profileApi.Profile))
+	http.HandleFunc("/api/profile/avatar", api.TokenMiddleware(profileApi.Avatar))
+	http.HandleFunc("/api/avatars/", profileApi.AvatarImage)
+	http.HandleFunc("/api/attachments", api.TokenMiddleware(attachmentApi.Upload))
+	http.HandleFunc("/api/attachments/", api.TokenMiddleware(attachmentApi.Download))
+	http.HandleFunc("/api/admin/users", adminApi.AdminMiddleware(adminApi.Users))
+	http.HandleFunc("/api/admin/users/disable", adminApi.AdminMiddleware(adminApi.DisableUser))
+	http.HandleFunc("/api/admin/users/disconnect", adminApi.AdminMiddleware(adminApi.DisconnectUser))
+	http.HandleFunc("/api/admin/rooms", adminApi.AdminMiddleware(adminApi.Rooms))
+	http.HandleFunc("/api/admin/rooms/delete", adminApi.AdminMiddleware(adminApi.DeleteRoom))
+	http.HandleFunc("/api/admin/rooms/archive", adminApi.AdminMiddleware(adminApi.ArchiveRoom))
+	http.HandleFunc("/api/admin/connections", adminApi.AdminMiddleware(adminApi.Connections))
 
 	log.Printf("Server is running on: %v", cfg.Http.Port)
 	log.Fatal(http.ListenAndServe(":"+cfg.Http.Port, nil))
@@ -3,23 +3,141 @@ package main
 import (
 	"encoding/json"
 	"log"
+	"time"
 
+	"github.com/nagohak/chat-app/dto"
 	"github.com/nagohak/chat-app/models"
 )
 
 const SendMessageAction = "send-message"
 const JoinRoomAction = "join-room"
 const LeaveRoomAction = "leave-room"
-const UserJoinedAction = "user-join"
-const UserLeftAction = "user-left"
+const PresenceChangedAction = "presence-changed"
+const SetStatusAction = "set-status"
+const UsersSummaryAction = "users-summary"
+const SearchUsersAction = "search-users"
+const UserUpdatedAction = "user-updated"
 const JoinRoomPrivateAction = "join-room-private"
 const RoomJoinedAction = "room-joined"
+const FetchHistoryAction = "fetch-history"
+const SessionStartedAction = "session-started"
+const ResumeAction = "resume"
+const EditMessageAction = "edit-message"
+const DeleteMessageAction = "delete-message"
+const MessageEditedAction = "message-edited"
+const MessageDeletedAction = "message-deleted"
+const FetchThreadAction = "fetch-thread"
+const UnsubscribeThreadAction = "unsubscribe-thread"
+const AddReactionAction = "add-reaction"
+const RemoveReactionAction = "remove-reaction"
+const ReactionsUpdatedAction = "reactions-updated"
+const TypingStartAction = "typing-start"
+const TypingStopAction = "typing-stop"
+const MarkReadAction = "mark-read"
+const ReadReceiptAction = "read-receipt"
+const FetchReceiptsAction = "fetch-receipts"
+const UnreadCountsAction = "unread-counts"
+const DirectRoomAction = "direct-room"
+const CreateGroupAction = "create-group"
+const AddMemberAction = "add-member"
+const RemoveMemberAction = "remove-member"
+const MemberAddedAction = "member-added"
+const MemberRemovedAction = "member-removed"
+const SetRoleAction = "set-role"
+const RoleChangedAction = "role-changed"
+const KickUserAction = "kick-user"
+const BanUserAction = "ban-user"
+const UnbanUserAction = "unban-user"
+const MuteUserAction = "mute-user"
+const UnmuteUserAction = "unmute-user"
+const UserKickedAction = "user-kicked"
+const UserBannedAction = "user-banned"
+const UserUnbannedAction = "user-unbanned"
+const UserMutedAction = "user-muted"
+const UserUnmutedAction = "user-unmuted"
+const ErrorAction = "error"
+const DisconnectUserAction = "disconnect-user"
+const RoomDeletedAction = "room-deleted"
+const ListRoomsAction = "list-rooms"
+const UpdateRoomAction = "update-room"
+const RoomUpdatedAction = "room-updated"
+const ArchiveRoomAction = "archive-room"
+const UnarchiveRoomAction = "unarchive-room"
+const DeleteRoomAction = "delete-room"
+const RoomArchivedAction = "room-archived"
+const RoomUnarchivedAction = "room-unarchived"
+const CreateInviteAction = "create-invite"
+const InviteCreatedAction = "invite-created"
+const RedeemInviteAction = "redeem-invite"
 
 type Message struct {
-	Action  string      `json:"action"`
-	Message string      `json:"message"`
-	Target  *Room       `json:"target"`
-	Sender  models.User `json:"sender"`
+	ID        string      `json:"id,omitempty"`
+	Action    string      `json:"action"`
+	Message   string      `json:"message"`
+	Target    *Room       `json:"target"`
+	Sender    models.User `json:"sender"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Seq       int64       `json:"seq,omitempty"`
+	EditedAt  *time.Time  `json:"editedAt,omitempty"`
+	Deleted   bool        `json:"deleted,omitempty"`
+	ReplyTo   string      `json:"replyTo,omitempty"`
+	Role      string      `json:"role,omitempty"`
+	// Status is the presence of the sender: online, away, dnd or offline
+	Status      string     `json:"status,omitempty"`
+	StatusText  string     `json:"statusText,omitempty"`
+	StatusEmoji string     `json:"statusEmoji,omitempty"`
+	LastSeen    *time.Time `json:"lastSeen,omitempty"`
+	// Duration of a ban, mute or invite in seconds
+	Duration int64 `json:"duration,omitempty"`
+	// MaxUses limits how often an invite can be redeemed, zero meaning no limit
+	MaxUses int `json:"maxUses,omitempty"`
+	// Reactions holds the number of reactions per emoji
+	Reactions map[string]int `json:"reactions,omitempty"`
+	// Unread holds the number of unread messages per room ID
+	Unread map[string]int `json:"unread,omitempty"`
+	// Receipts holds the last read sequence number per user ID
+	Receipts map[string]int64 `json:"receipts,omitempty"`
+	History  []*Message       `json:"history,omitempty"`
+	// Members holds user IDs, e.g. the invitees of a new group
+	Members []string `json:"members,omitempty"`
+	// Acks holds the last sequence number the client has seen per room ID
+	Acks map[string]int64 `json:"acks,omitempty"`
+	// Offset pages through directory listings
+	Offset int               `json:"offset,omitempty"`
+	Rooms  []dto.RoomListing `json:"rooms,omitempty"`
+	// Cursor pages through user searches, it is the ID of the last user of the previous page
+	Cursor       string            `json:"cursor,omitempty"`
+	Users        []dto.UserListing `json:"users,omitempty"`
+	UsersSummary *UsersSummary     `json:"usersSummary,omitempty"`
+	Profile      *dto.ProfileInfo  `json:"profile,omitempty"`
+	// Attachments of a chat message, clients send only their IDs
+	Attachments []*dto.AttachmentInfo `json:"attachments,omitempty"`
+
+	// stored is closed once the room has stored and published the message
+	stored chan struct{}
+	// storeErr tells why the message was dropped, it is set before stored is closed
+	storeErr error
+}
+
+// newMessageFromModel restores a stored chat message of the given room.
+func newMessageFromModel(room *Room, message models.Message) *Message {
+	m := &Message{
+		ID:        message.GetId(),
+		Action:    SendMessageAction,
+		Message:   message.GetMessage(),
+		Target:    room,
+		Sender:    message.GetSender(),
+		CreatedAt: message.GetCreatedAt(),
+		Seq:       message.GetSeq(),
+		Deleted:   message.GetDeleted(),
+		ReplyTo:   message.GetReplyTo(),
+	}
+
+	if editedAt := message.GetEditedAt(); !editedAt.IsZero() {
+		m.EditedAt = &editedAt
+	}
+
+	return m
 }
 
 func (m *Message) UnmarshalJSON(data []byte) error {
@@ -39,6 +157,45 @@ func (m *Message) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+func (m *Message) GetId() string {
+	return m.ID
+}
+
+func (m *Message) GetRoomId() string {
+	return m.Target.GetId()
+}
+
+func (m *Message) GetSender() models.User {
+	return m.Sender
+}
+
+func (m *Message) GetMessage() string {
+	return m.Message
+}
+
+func (m *Message) GetCreatedAt() time.Time {
+	return m.CreatedAt
+}
+
+func (m *Message) GetSeq() int64 {
+	return m.Seq
+}
+
+func (m *Message) GetEditedAt() time.Time {
+	if m.EditedAt == nil {
+		return time.Time{}
+	}
+	return *m.EditedAt
+}
+
+func (m *Message) GetDeleted() bool {
+	return m.Deleted
+}
+
+func (m *Message) GetReplyTo() string {
+	return m.ReplyTo
+}
+
 func (m *Message) encode() []byte {
 	json, err := json.Marshal(m)
 	if err != nil {
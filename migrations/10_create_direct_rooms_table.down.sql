@@ -0,0 +1 @@
+DROP TABLE IF EXISTS direct_rooms;
\ No newline at end of file
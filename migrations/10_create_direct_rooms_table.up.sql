@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS direct_rooms (
+	room_id VARCHAR(255) NOT NULL PRIMARY KEY,
+	user_a VARCHAR(255) NOT NULL,
+	user_b VARCHAR(255) NOT NULL,
+	UNIQUE (user_a, user_b),
+	CHECK (user_a < user_b)
+);
+
+CREATE INDEX IF NOT EXISTS direct_rooms_user_b_idx ON direct_rooms (user_b);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS room_members (
+	room_id VARCHAR(255) NOT NULL,
+	user_id VARCHAR(255) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS room_members_user_id_idx ON room_members (user_id);
+
+INSERT INTO room_members (room_id, user_id)
+	SELECT room_id, user_a FROM direct_rooms
+	UNION SELECT room_id, user_b FROM direct_rooms
+	ON CONFLICT DO NOTHING;
@@ -0,0 +1 @@
+ALTER TABLE room_members DROP COLUMN IF EXISTS role;
\ No newline at end of file
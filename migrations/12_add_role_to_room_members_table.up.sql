@@ -0,0 +1 @@
+ALTER TABLE room_members ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'member';
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS room_sanctions (
+	room_id VARCHAR(255) NOT NULL,
+	user_id VARCHAR(255) NOT NULL,
+	kind VARCHAR(32) NOT NULL,
+	created_by VARCHAR(255) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NULL,
+	PRIMARY KEY (room_id, user_id, kind)
+);
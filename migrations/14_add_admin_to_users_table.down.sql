@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_name_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS disabled;
+ALTER TABLE users DROP COLUMN IF EXISTS admin;
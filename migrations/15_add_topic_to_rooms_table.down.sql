@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS rooms_name_prefix_idx;
+
+ALTER TABLE rooms DROP COLUMN IF EXISTS topic;
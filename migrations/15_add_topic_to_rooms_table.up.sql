@@ -0,0 +1,3 @@
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS topic VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS rooms_name_prefix_idx ON rooms (lower(name) text_pattern_ops);
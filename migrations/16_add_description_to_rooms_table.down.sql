@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS room_renames;
+
+ALTER TABLE rooms DROP COLUMN IF EXISTS description;
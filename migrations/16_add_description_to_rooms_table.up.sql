@@ -0,0 +1,11 @@
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS room_renames (
+	room_id VARCHAR(255) NOT NULL,
+	old_name VARCHAR(255) NOT NULL,
+	new_name VARCHAR(255) NOT NULL,
+	renamed_by VARCHAR(255) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS room_renames_room_id_idx ON room_renames (room_id, created_at);
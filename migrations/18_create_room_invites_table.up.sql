@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS room_invites (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	room_id VARCHAR(255) NOT NULL,
+	created_by VARCHAR(255) NOT NULL,
+	role VARCHAR(32) NOT NULL DEFAULT 'member',
+	max_uses INTEGER NOT NULL DEFAULT 0,
+	uses INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS room_invites_room_id_idx ON room_invites (room_id);
@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS last_seen;
+ALTER TABLE users DROP COLUMN IF EXISTS status_emoji;
+ALTER TABLE users DROP COLUMN IF EXISTS status_text;
+ALTER TABLE users DROP COLUMN IF EXISTS status;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_name_order_idx;
+DROP INDEX IF EXISTS users_username_prefix_idx;
+DROP INDEX IF EXISTS users_name_prefix_idx;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS attachments (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	uploader_id VARCHAR(255) NOT NULL,
+	room_id VARCHAR(255) NULL,
+	message_id VARCHAR(255) NULL,
+	name VARCHAR(255) NOT NULL,
+	mime_type VARCHAR(255) NOT NULL,
+	size BIGINT NOT NULL,
+	thumbnail BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS attachments_message_id_idx ON attachments (message_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS messages (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	room_id VARCHAR(255) NOT NULL,
+	sender_id VARCHAR(255) NOT NULL,
+	sender_name VARCHAR(255) NOT NULL,
+	message TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS messages_room_id_created_at_idx ON messages (room_id, created_at);
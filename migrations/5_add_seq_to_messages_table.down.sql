@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS messages_room_id_seq_idx;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS seq;
@@ -0,0 +1,3 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS seq BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS messages_room_id_seq_idx ON messages (room_id, seq);
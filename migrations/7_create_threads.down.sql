@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS thread_participants;
+
+DROP INDEX IF EXISTS messages_reply_to_seq_idx;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS reply_to;
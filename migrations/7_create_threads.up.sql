@@ -0,0 +1,9 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS reply_to VARCHAR(255) NULL;
+
+CREATE INDEX IF NOT EXISTS messages_reply_to_seq_idx ON messages (reply_to, seq);
+
+CREATE TABLE IF NOT EXISTS thread_participants (
+	message_id VARCHAR(255) NOT NULL,
+	user_id VARCHAR(255) NOT NULL,
+	PRIMARY KEY (message_id, user_id)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS reactions (
+	message_id VARCHAR(255) NOT NULL,
+	user_id VARCHAR(255) NOT NULL,
+	emoji VARCHAR(64) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (message_id, user_id, emoji)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS read_receipts;
\ No newline at end of file
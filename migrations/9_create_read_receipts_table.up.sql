@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS read_receipts (
+	user_id VARCHAR(255) NOT NULL,
+	room_id VARCHAR(255) NOT NULL,
+	last_read_seq BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (user_id, room_id)
+);
+
+CREATE INDEX IF NOT EXISTS read_receipts_room_id_idx ON read_receipts (room_id);
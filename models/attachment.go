@@ -0,0 +1,29 @@
+package models
+
+type Attachment interface {
+	GetId() string
+	GetUploaderId() string
+	// GetRoomId returns the room the attachment was sent to, empty until it is sent.
+	GetRoomId() string
+	// GetMessageId returns the message the attachment was sent with, empty until it is sent.
+	GetMessageId() string
+	GetName() string
+	GetMimeType() string
+	GetSize() int64
+	// GetThumbnail tells whether a thumbnail image was generated.
+	GetThumbnail() bool
+}
+
+type AttachmentRepository interface {
+	AddAttachment(id string, uploaderId string, name string, mimeType string, size int64, thumbnail bool) error
+	FindAttachment(id string) (Attachment, error)
+	// AttachToMessage binds the given attachments to the message, skipping attachments of other
+	// uploaders and attachments already sent. It returns the attachments it bound.
+	AttachToMessage(ids []string, uploaderId string, roomId string, messageId string) ([]Attachment, error)
+	// GetMessageAttachments returns the attachments of the given messages by message ID.
+	GetMessageAttachments(messageIds []string) (map[string][]Attachment, error)
+	// DeleteMessageAttachments deletes the attachments of the message and returns their IDs.
+	DeleteMessageAttachments(messageId string) ([]string, error)
+	// DeleteRoomAttachments deletes the attachments sent to the room and returns their IDs.
+	DeleteRoomAttachments(roomId string) ([]string, error)
+}
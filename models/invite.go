@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type Invite interface {
+	GetId() string
+	GetRoomId() string
+	GetRole() string
+}
+
+type InviteRepository interface {
+	// AddInvite stores an invite that can be used maxUses times, or without limit if it is zero,
+	// until expiresAt, or forever if it is zero.
+	AddInvite(id string, roomId string, createdBy string, role string, maxUses int, expiresAt time.Time) error
+	// UseInvite counts one use of the invite and returns it, or nil if it is unknown, expired or used up.
+	UseInvite(id string) (Invite, error)
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type Message interface {
+	GetId() string
+	GetRoomId() string
+	GetSender() User
+	GetMessage() string
+	GetCreatedAt() time.Time
+	GetSeq() int64
+	GetEditedAt() time.Time
+	GetDeleted() bool
+	GetReplyTo() string
+}
+
+type MessageRepository interface {
+	AddMessage(message Message) error
+	GetRoomMessages(roomId string, beforeSeq int64, limit int) ([]Message, error)
+	GetRoomMessagesAfter(roomId string, afterSeq int64, limit int) ([]Message, error)
+	GetThreadMessages(parentId string, beforeSeq int64, limit int) ([]Message, error)
+	AddThreadParticipant(messageId string, userId string) error
+	RemoveThreadParticipant(messageId string, userId string) error
+	GetThreadParticipants(messageId string) ([]string, error)
+	FindMessageById(id string) (Message, error)
+	EditMessage(id string, text string, editedAt time.Time) error
+	DeleteMessage(id string, deletedAt time.Time) error
+	GetLastSeq(roomId string) (int64, error)
+}
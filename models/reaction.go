@@ -0,0 +1,8 @@
+package models
+
+type ReactionRepository interface {
+	AddReaction(messageId string, userId string, emoji string) error
+	RemoveReaction(messageId string, userId string, emoji string) error
+	// GetReactionCounts returns the number of reactions per emoji for each of the given messages.
+	GetReactionCounts(messageIds []string) (map[string]map[string]int, error)
+}
@@ -0,0 +1,11 @@
+package models
+
+type ReceiptRepository interface {
+	// MarkRead moves the last read sequence of the user in the room forward, never backwards.
+	MarkRead(userId string, roomId string, seq int64) error
+	// GetRoomReceipts returns the last read sequence of every user of the room.
+	GetRoomReceipts(roomId string) (map[string]int64, error)
+	GetUnreadCount(userId string, roomId string) (int, error)
+	// GetUnreadCounts returns the unread count of every room the user is a member of.
+	GetUnreadCounts(userId string) (map[string]int, error)
+}
@@ -1,12 +1,73 @@
 package models
 
+import "time"
+
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+const (
+	SanctionBan  = "ban"
+	SanctionMute = "mute"
+)
+
 type Room interface {
 	GetId() string
 	GetName() string
 	GetPrivate() bool
+	GetTopic() string
+	GetDescription() string
+	GetArchived() bool
+}
+
+// DirectRoom is a private conversation between two users, seen from one of them.
+type DirectRoom interface {
+	Room
+	GetPeer() User
+}
+
+// RoomSummary is a public room as listed in the room directory.
+type RoomSummary interface {
+	Room
+	GetMemberCount() int
+	// GetLastActivity returns when the last message was sent, zero if there is none.
+	GetLastActivity() time.Time
 }
 
 type RoomRepository interface {
 	AddRoom(room Room) error
 	FindRoomByName(name string) (Room, error)
+	FindRoomById(id string) (Room, error)
+	// SearchRooms returns rooms whose name contains the query.
+	SearchRooms(query string, limit int, offset int) ([]Room, error)
+	// ListPublicRooms returns public rooms that are not archived and whose name starts with the prefix, ignoring case.
+	ListPublicRooms(prefix string, limit int, offset int) ([]RoomSummary, error)
+	UpdateRoom(id string, topic string, description string) error
+	// RenameRoom changes the name of the room and records the previous one.
+	RenameRoom(id string, name string, renamedBy string) error
+	// SetRoomArchived makes the room read-only and hides it from the directory, or undoes that.
+	SetRoomArchived(id string, archived bool) error
+	// DeleteRoom removes the room together with its members, messages and other data.
+	DeleteRoom(id string) error
+	AddDirectRoom(roomId string, userA string, userB string) error
+	FindDirectRoom(userA string, userB string) (Room, error)
+	GetDirectRooms(userId string) ([]DirectRoom, error)
+	// AddRoomMember adds the user with the given role, keeping the role of an existing member.
+	AddRoomMember(roomId string, userId string, role string) error
+	// AddRoomMembers adds all the users with the given role, or none of them.
+	AddRoomMembers(roomId string, userIds []string, role string) error
+	RemoveRoomMember(roomId string, userId string) error
+	IsRoomMember(roomId string, userId string) (bool, error)
+	GetRoomMemberIds(roomId string) ([]string, error)
+	// GetRoomRole returns the role of the user in the room, or an empty string for non members.
+	GetRoomRole(roomId string, userId string) (string, error)
+	SetRoomRole(roomId string, userId string, role string) error
+	GetUserRooms(userId string) ([]Room, error)
+	// AddSanction bans or mutes the user in the room until expiresAt, or forever if it is zero.
+	AddSanction(roomId string, userId string, kind string, createdBy string, expiresAt time.Time) error
+	RemoveSanction(roomId string, userId string, kind string) error
+	// GetSanction reports whether the sanction is active and until when, zero meaning forever.
+	GetSanction(roomId string, userId string, kind string) (bool, time.Time, error)
 }
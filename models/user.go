@@ -1,6 +1,10 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type User interface {
 	GetID() string
@@ -11,6 +15,32 @@ type DbUser interface {
 	User
 	GetUsername() string
 	GetPassword() string
+	GetAdmin() bool
+	GetDisabled() bool
+}
+
+// UserStatus is the availability a user picked, with an optional custom text and emoji.
+type UserStatus interface {
+	GetStatus() string
+	GetStatusText() string
+	GetStatusEmoji() string
+}
+
+// Profile is what a user tells others about themselves.
+type Profile interface {
+	GetDisplayName() string
+	GetBio() string
+	GetTimezone() string
+	// GetAvatar returns the ID of the avatar image, empty if the user has none.
+	GetAvatar() string
+}
+
+// UserSummary is a user as listed in the user directory.
+type UserSummary interface {
+	User
+	UserStatus
+	Profile
+	GetLastSeen() time.Time
 }
 
 type UserRepository interface {
@@ -20,4 +50,19 @@ type UserRepository interface {
 	FindUserById(id string) (User, error)
 	GetAllUsers() ([]User, error)
 	FindUserByUsername(username string) (DbUser, error)
+	FindDbUserById(id string) (DbUser, error)
+	// SearchUsers returns users whose name or username contains the query.
+	SearchUsers(query string, limit int, offset int) ([]DbUser, error)
+	SetUserDisabled(id string, disabled bool) error
+	SetUserStatus(id string, status, text, emoji string) error
+	// GetUserStatuses returns the status of every given user that exists, by user ID.
+	GetUserStatuses(ids []string) (map[string]UserStatus, error)
+	SetLastSeen(id string, lastSeen time.Time) error
+	// ListUsers returns users whose name or username starts with prefix, ordered by name and
+	// starting after the user with the ID after, if given.
+	ListUsers(prefix string, after string, limit int) ([]UserSummary, error)
+	CountUsers() (int, error)
+	FindProfile(id string) (Profile, error)
+	UpdateProfile(id string, displayName, bio, timezone string) error
+	SetAvatar(id string, avatar string) error
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/nagohak/chat-app/models"
+)
+
+const mutedMessage = "You are muted in this room"
+
+// handleModerationMessage kicks, bans or mutes the user in message.Message, or lifts a ban or mute.
+// Bans and mutes last message.Duration seconds, or forever when no duration is given.
+func (client *Client) handleModerationMessage(message Message) {
+	if message.Target == nil || message.Message == "" || message.Message == client.GetID() {
+		return
+	}
+
+	room := client.wsServer.findRoomByID(message.Target.GetId())
+	if room == nil {
+		return
+	}
+
+	userID := message.Message
+	if !client.can(room, KickPermission) || !client.outranks(room, userID) {
+		client.sendError(room, "Not allowed to moderate this user")
+		return
+	}
+
+	var expiresAt time.Time
+	if message.Duration > 0 {
+		expiresAt = time.Now().Add(time.Duration(message.Duration) * time.Second)
+	}
+
+	repository := client.wsServer.roomRepository
+
+	var event string
+	var err error
+	switch message.Action {
+	case KickUserAction:
+		event = UserKickedAction
+		err = repository.RemoveRoomMember(room.GetId(), userID)
+	case BanUserAction:
+		event = UserBannedAction
+		if err = repository.AddSanction(room.GetId(), userID, models.SanctionBan, client.GetID(), expiresAt); err == nil {
+			err = repository.RemoveRoomMember(room.GetId(), userID)
+		}
+	case UnbanUserAction:
+		event = UserUnbannedAction
+		err = repository.RemoveSanction(room.GetId(), userID, models.SanctionBan)
+	case MuteUserAction:
+		event = UserMutedAction
+		err = repository.AddSanction(room.GetId(), userID, models.SanctionMute, client.GetID(), expiresAt)
+	case UnmuteUserAction:
+		event = UserUnmutedAction
+		err = repository.RemoveSanction(room.GetId(), userID, models.SanctionMute)
+	}
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// Kicks and bans are enforced by every node when the event arrives through the room channel.
+	room.publishRoomMessage(&Message{
+		Action:   event,
+		Message:  userID,
+		Target:   room,
+		Sender:   client,
+		Duration: message.Duration,
+	})
+}
+
+func (server *WsServer) isMuted(room *Room, userID string) bool {
+	muted, _, err := server.roomRepository.GetSanction(room.GetId(), userID, models.SanctionMute)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return muted
+}
+
+func (client *Client) isMuted(room *Room) bool {
+	return client.wsServer.isMuted(room, client.GetID())
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log"
+
+	"github.com/nagohak/chat-app/models"
+)
+
+type Permission int
+
+const (
+	PostPermission Permission = iota
+	// Edit or delete messages of other users
+	ModerateMessagesPermission
+	InvitePermission
+	KickPermission
+	ManageRolesPermission
+	// Change the topic and description
+	EditRoomPermission
+	RenameRoomPermission
+	// Mint invite links that anyone can redeem
+	CreateInviteLinkPermission
+)
+
+var rolePermissions = map[string]map[Permission]bool{
+	models.RoleOwner: {
+		PostPermission:             true,
+		ModerateMessagesPermission: true,
+		InvitePermission:           true,
+		KickPermission:             true,
+		ManageRolesPermission:      true,
+		EditRoomPermission:         true,
+		RenameRoomPermission:       true,
+		CreateInviteLinkPermission: true,
+	},
+	models.RoleModerator: {
+		PostPermission:             true,
+		ModerateMessagesPermission: true,
+		InvitePermission:           true,
+		KickPermission:             true,
+		EditRoomPermission:         true,
+	},
+	models.RoleMember: {
+		PostPermission: true,
+	},
+}
+
+var roleRank = map[string]int{
+	models.RoleOwner:     3,
+	models.RoleModerator: 2,
+	models.RoleMember:    1,
+}
+
+// roleOf returns the role of the user in the room, or an empty string for non members.
+func (server *WsServer) roleOf(room *Room, userID string) string {
+	role, err := server.roomRepository.GetRoomRole(room.GetId(), userID)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return role
+}
+
+// can reports whether the user's role in the room grants the permission.
+// Archived rooms are read-only, nobody is granted anything there.
+func (server *WsServer) can(room *Room, userID string, permission Permission) bool {
+	if room.GetArchived() {
+		return false
+	}
+
+	return rolePermissions[server.roleOf(room, userID)][permission]
+}
+
+func (client *Client) roleIn(room *Room) string {
+	return client.wsServer.roleOf(room, client.GetID())
+}
+
+// can reports whether the client's role in the room grants the permission.
+func (client *Client) can(room *Room, permission Permission) bool {
+	return client.wsServer.can(room, client.GetID(), permission)
+}
+
+// outranks reports whether the client's role in the room is higher than the role of the user.
+func (client *Client) outranks(room *Room, userID string) bool {
+	role, err := client.wsServer.roomRepository.GetRoomRole(room.GetId(), userID)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	return roleRank[client.roleIn(room)] > roleRank[role]
+}
+
+// handleSetRoleMessage lets the owner make a member moderator or demote a moderator.
+func (client *Client) handleSetRoleMessage(message Message) {
+	if message.Target == nil || (message.Role != models.RoleModerator && message.Role != models.RoleMember) {
+		return
+	}
+
+	room := client.wsServer.findRoomByID(message.Target.GetId())
+	if room == nil || !client.can(room, ManageRolesPermission) {
+		return
+	}
+
+	repository := client.wsServer.roomRepository
+
+	role, err := repository.GetRoomRole(room.GetId(), message.Message)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if role == "" || role == models.RoleOwner {
+		return
+	}
+
+	if err := repository.SetRoomRole(room.GetId(), message.Message, message.Role); err != nil {
+		log.Println(err)
+		return
+	}
+
+	room.publishRoomMessage(&Message{
+		Action:  RoleChangedAction,
+		Message: message.Message,
+		Target:  room,
+		Sender:  client,
+		Role:    message.Role,
+	})
+}
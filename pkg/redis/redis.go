@@ -4,6 +4,19 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
+// Nil is returned by the client when a key does not exist.
+const Nil = redis.Nil
+
+// ZRangeBy selects sorted set members by score.
+type ZRangeBy = redis.ZRangeBy
+
+// Script is a Lua script that is run atomically on the server.
+type Script = redis.Script
+
+func NewScript(src string) *Script {
+	return redis.NewScript(src)
+}
+
 type Client struct {
 	*redis.Client
 }
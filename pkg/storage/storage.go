@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when there is no blob under a key.
+	ErrNotFound = errors.New("blob not found")
+	// ErrInvalidKey is returned for keys that are empty or not clean relative paths.
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Storage keeps blobs under slash separated keys.
+type Storage interface {
+	Put(key string, r io.Reader) error
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes every blob whose key starts with prefix followed by a slash, or the blob under prefix itself.
+	Delete(prefix string) error
+}
+
+type local struct {
+	dir string
+}
+
+// NewLocal stores blobs as files below dir, creating it if needed.
+func NewLocal(dir string) (Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &local{dir: dir}, nil
+}
+
+// path maps the key to a file below the storage directory. Keys that are not clean
+// relative paths are refused, they could name the directory itself or escape it.
+func (s *local) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || path.IsAbs(key) || path.Clean(key) != key ||
+		strings.HasPrefix(key, "../") || strings.Contains(key, `\`) {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *local) Put(key string, r io.Reader) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial blob.
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *local) Open(key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return file, err
+}
+
+func (s *local) Delete(prefix string) error {
+	name, err := s.path(prefix)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(name)
+}
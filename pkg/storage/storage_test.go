@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newLocal(t *testing.T) (Storage, string) {
+	parent := t.TempDir()
+	blobs, err := NewLocal(filepath.Join(parent, "blobs"))
+	assert.NoError(t, err)
+
+	return blobs, parent
+}
+
+func TestLocalPutOpen(t *testing.T) {
+	blobs, _ := newLocal(t)
+
+	assert.NoError(t, blobs.Put("attachments/a1/file", bytes.NewBufferString("hello")))
+
+	blob, err := blobs.Open("attachments/a1/file")
+	assert.NoError(t, err)
+	defer blob.Close()
+
+	data, err := io.ReadAll(blob)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestLocalOpenMissing(t *testing.T) {
+	blobs, _ := newLocal(t)
+
+	_, err := blobs.Open("attachments/a1/file")
+
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestLocalDeletePrefix(t *testing.T) {
+	blobs, _ := newLocal(t)
+	assert.NoError(t, blobs.Put("attachments/a1/file", bytes.NewBufferString("file")))
+	assert.NoError(t, blobs.Put("attachments/a1/thumbnail.png", bytes.NewBufferString("thumbnail")))
+	assert.NoError(t, blobs.Put("attachments/a10/file", bytes.NewBufferString("other")))
+
+	assert.NoError(t, blobs.Delete("attachments/a1"))
+
+	_, err := blobs.Open("attachments/a1/file")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = blobs.Open("attachments/a1/thumbnail.png")
+	assert.Equal(t, ErrNotFound, err)
+
+	blob, err := blobs.Open("attachments/a10/file")
+	assert.NoError(t, err)
+	blob.Close()
+}
+
+func TestLocalRejectsInvalidKeys(t *testing.T) {
+	blobs, parent := newLocal(t)
+	assert.NoError(t, blobs.Put("attachments/a1/file", bytes.NewBufferString("hello")))
+
+	keys := []string{"", ".", "..", "../escape", "attachments/../../escape", "/etc/passwd",
+		"attachments//a1", "attachments/a1/", `..\escape`}
+	for _, key := range keys {
+		assert.Equal(t, ErrInvalidKey, blobs.Put(key, bytes.NewBufferString("x")), key)
+
+		_, err := blobs.Open(key)
+		assert.Equal(t, ErrInvalidKey, err, key)
+
+		assert.Equal(t, ErrInvalidKey, blobs.Delete(key), key)
+	}
+
+	_, err := os.Stat(filepath.Join(parent, "escape"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Deleting "." or ".." would have taken everything with it.
+	blob, err := blobs.Open("attachments/a1/file")
+	assert.NoError(t, err)
+	blob.Close()
+}
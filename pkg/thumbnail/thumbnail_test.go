@@ -0,0 +1,107 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFitLandscape(t *testing.T) {
+	thumb := Fit(image.NewRGBA(image.Rect(0, 0, 640, 480)), 320)
+
+	assert.Equal(t, image.Rect(0, 0, 320, 240), thumb.Bounds())
+}
+
+func TestFitPortrait(t *testing.T) {
+	thumb := Fit(image.NewRGBA(image.Rect(0, 0, 100, 400)), 320)
+
+	assert.Equal(t, image.Rect(0, 0, 80, 320), thumb.Bounds())
+}
+
+func TestFitKeepsOnePixel(t *testing.T) {
+	thumb := Fit(image.NewRGBA(image.Rect(0, 0, 2000, 1)), 320)
+
+	assert.Equal(t, image.Rect(0, 0, 320, 1), thumb.Bounds())
+}
+
+func TestFitSmallImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+
+	assert.Same(t, img, Fit(img, 320))
+}
+
+func TestFitAveragesPixels(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	img.Set(1, 0, color.RGBA{B: 255, A: 255})
+
+	thumb := Fit(img, 1)
+
+	assert.Equal(t, color.RGBA{R: 127, B: 127, A: 255}, color.RGBAModel.Convert(thumb.At(0, 0)))
+}
+
+func TestSquareCropsCentre(t *testing.T) {
+	// Red, green and blue bands side by side, the square in the middle is all green.
+	img := image.NewRGBA(image.Rect(10, 20, 310, 120))
+	bands := []color.RGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}}
+	for x := 10; x < 310; x++ {
+		for y := 20; y < 120; y++ {
+			img.Set(x, y, bands[(x-10)/100])
+		}
+	}
+
+	thumb := Square(img, 64)
+
+	assert.Equal(t, image.Rect(0, 0, 64, 64), thumb.Bounds())
+	assert.Equal(t, color.RGBA{G: 255, A: 255}, color.RGBAModel.Convert(thumb.At(0, 0)))
+	assert.Equal(t, color.RGBA{G: 255, A: 255}, color.RGBAModel.Convert(thumb.At(63, 63)))
+}
+
+func TestSquareDoesNotUpscale(t *testing.T) {
+	thumb := Square(image.NewRGBA(image.Rect(0, 0, 100, 50)), 256)
+
+	assert.Equal(t, image.Rect(0, 0, 50, 50), thumb.Bounds())
+}
+
+func TestDecodeFormats(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+
+	encoders := map[string]func(*bytes.Buffer) error{
+		"png":  func(buf *bytes.Buffer) error { return png.Encode(buf, img) },
+		"jpeg": func(buf *bytes.Buffer) error { return jpeg.Encode(buf, img, nil) },
+		"gif":  func(buf *bytes.Buffer) error { return gif.Encode(buf, img, nil) },
+	}
+	for format, encode := range encoders {
+		var buf bytes.Buffer
+		assert.NoError(t, encode(&buf), format)
+
+		decoded, err := Decode(bytes.NewReader(buf.Bytes()), 100)
+
+		assert.NoError(t, err, format)
+		assert.Equal(t, 40, decoded.Bounds().Dx(), format)
+		assert.Equal(t, 30, decoded.Bounds().Dy(), format)
+	}
+}
+
+func TestDecodeUnsupported(t *testing.T) {
+	for _, data := range []string{"", "plain text", "BM\x36\x00\x00\x00", "<svg xmlns=\"http://www.w3.org/2000/svg\"/>"} {
+		_, err := Decode(bytes.NewReader([]byte(data)), 100)
+
+		assert.ErrorIs(t, err, image.ErrFormat, data)
+	}
+}
+
+func TestDecodeTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 101, 10))))
+
+	_, err := Decode(bytes.NewReader(buf.Bytes()), 100)
+
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/nagohak/chat-app/models"
+	"github.com/nagohak/chat-app/pkg/redis"
+)
+
+const (
+	// presenceUsersKey holds the online users scored by when their presence expires
+	presenceUsersKey = "presence:users"
+	// presenceUserKey holds the nodes a user is connected to scored by when they expire
+	presenceUserKey = "presence:user:%s"
+	// presenceAwayKey holds the online users that have been inactive on every node
+	presenceAwayKey = "presence:away"
+	// presenceActiveKey exists while the user has been active recently
+	presenceActiveKey = "presence:active:%s"
+
+	// How often a node refreshes the presence of its users, presence expires after three periods
+	presenceHeartbeatPeriod = 30 * time.Second
+	presenceTTL             = 3 * presenceHeartbeatPeriod
+
+	PresenceOnline       = "online"
+	PresenceAway         = "away"
+	PresenceDoNotDisturb = "dnd"
+	PresenceOffline      = "offline"
+)
+
+// presenceOnlineScript marks the users as connected to the node and, if asked to, shows the
+// inactive ones as away. KEYS are the online users, the away users and then the presence and
+// activity keys of each user in ARGV[5:]. It returns the users that were offline on every node
+// before and the users that went away.
+var presenceOnlineScript = redis.NewScript(`
+local online, away = {}, {}
+for i = 5, #ARGV do
+	local user = ARGV[i]
+	local userKey = KEYS[(i - 5) * 2 + 3]
+	local activeKey = KEYS[(i - 5) * 2 + 4]
+	redis.call('ZADD', userKey, ARGV[2], ARGV[1])
+	redis.call('PEXPIRE', userKey, ARGV[3])
+	local current = redis.call('ZSCORE', KEYS[1], user)
+	if not current then
+		redis.call('ZADD', KEYS[1], ARGV[2], user)
+		table.insert(online, user)
+	elseif tonumber(current) < tonumber(ARGV[2]) then
+		redis.call('ZADD', KEYS[1], ARGV[2], user)
+	end
+	if ARGV[4] == '1' and redis.call('EXISTS', activeKey) == 0 and redis.call('SADD', KEYS[2], user) == 1 then
+		table.insert(away, user)
+	end
+end
+return {online, away}
+`)
+
+// presenceOfflineScript removes the node, if any, and the expired nodes from the user.
+// It returns 1 if the user is no longer connected to any node.
+var presenceOfflineScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+local latest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if #latest == 0 then
+	redis.call('DEL', KEYS[1])
+	return redis.call('ZREM', KEYS[2], ARGV[3])
+end
+redis.call('ZADD', KEYS[2], latest[2], ARGV[3])
+return 0
+`)
+
+// userConnected is called when the first connection of the user opens on this node.
+func (server *WsServer) userConnected(user models.User) {
+	server.markOnline([]string{user.GetID()}, false)
+}
+
+// userDisconnected is called when the last connection of the user closes on this node.
+func (server *WsServer) userDisconnected(user models.User, lastSeen time.Time) {
+	server.markOffline(user.GetID(), server.nodeID, &lastSeen)
+}
+
+// refreshPresence renews the presence of the users connected to this node and takes
+// users offline whose nodes stopped refreshing them. It runs on Run, so the users are
+// refreshed in one round trip however many are connected.
+func (server *WsServer) refreshPresence() {
+	seen := make(map[string]bool)
+	userIDs := make([]string, 0, len(server.clients))
+	for client := range server.clients {
+		if !seen[client.GetID()] {
+			seen[client.GetID()] = true
+			userIDs = append(userIDs, client.GetID())
+		}
+	}
+
+	if len(userIDs) > 0 {
+		server.markOnline(userIDs, server.awayAfter > 0)
+	}
+
+	expired, err := server.redis.ZRangeByScore(ctx, presenceUsersKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, userID := range expired {
+		server.markOffline(userID, "", nil)
+	}
+}
+
+// markOnline marks the users as connected to this node and announces the ones that came online.
+// With checkAway, users no node saw activity from for the away period are shown as away.
+func (server *WsServer) markOnline(userIDs []string, checkAway bool) {
+	expiresAt := time.Now().Add(presenceTTL).UnixMilli()
+
+	keys := make([]string, 0, 2+2*len(userIDs))
+	keys = append(keys, presenceUsersKey, presenceAwayKey)
+	args := make([]interface{}, 0, 4+len(userIDs))
+	args = append(args, server.nodeID, expiresAt, presenceTTL.Milliseconds(), checkAway)
+	for _, userID := range userIDs {
+		keys = append(keys, fmt.Sprintf(presenceUserKey, userID), fmt.Sprintf(presenceActiveKey, userID))
+		args = append(args, userID)
+	}
+
+	result, err := presenceOnlineScript.Run(ctx, server.redis, keys, args...).Slice()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// Users that came online are announced as away already if they are.
+	announced := make(map[string]bool)
+	for _, userID := range scriptStrings(result[0]) {
+		announced[userID] = true
+		server.publishPresence(server.onlinePresence(userID))
+	}
+	for _, userID := range scriptStrings(result[1]) {
+		if !announced[userID] {
+			server.publishAwayChange(userID)
+		}
+	}
+}
+
+// scriptStrings converts a list of strings returned by a script.
+func scriptStrings(value interface{}) []string {
+	values, _ := value.([]interface{})
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			strs = append(strs, str)
+		}
+	}
+
+	return strs
+}
+
+// markOffline removes the node from the user's presence, an empty nodeID only removes expired nodes.
+// lastSeen is passed on to the clients if the user went offline and it is known.
+func (server *WsServer) markOffline(userID string, nodeID string, lastSeen *time.Time) {
+	keys := []string{fmt.Sprintf(presenceUserKey, userID), presenceUsersKey}
+	changed, err := presenceOfflineScript.Run(ctx, server.redis, keys, nodeID, time.Now().UnixMilli(), userID).Int()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if changed != 1 {
+		return
+	}
+
+	if err := server.redis.SRem(ctx, presenceAwayKey, userID).Err(); err != nil {
+		log.Println(err)
+	}
+	if err := server.redis.Del(ctx, fmt.Sprintf(presenceActiveKey, userID)).Err(); err != nil {
+		log.Println(err)
+	}
+
+	server.publishPresence(&Message{
+		Action:   PresenceChangedAction,
+		Sender:   server.presenceUser(userID),
+		Status:   PresenceOffline,
+		LastSeen: lastSeen,
+	})
+}
+
+// onlinePresence returns the presence-changed event for an online user, showing the status
+// the user picked and away if the user picked online but is inactive.
+func (server *WsServer) onlinePresence(userID string) *Message {
+	statuses, err := server.userRepository.GetUserStatuses([]string{userID})
+	if err != nil {
+		log.Println(err)
+	}
+
+	away, err := server.redis.SIsMember(ctx, presenceAwayKey, userID).Result()
+	if err != nil {
+		log.Println(err)
+	}
+
+	return presenceMessage(server.presenceUser(userID), statuses[userID], away)
+}
+
+func presenceMessage(user models.User, status models.UserStatus, away bool) *Message {
+	message := &Message{
+		Action: PresenceChangedAction,
+		Sender: user,
+		Status: PresenceOnline,
+	}
+
+	if status != nil {
+		message.Status = shownStatus(status, away)
+		message.StatusText = status.GetStatusText()
+		message.StatusEmoji = status.GetStatusEmoji()
+	} else if away {
+		message.Status = PresenceAway
+	}
+
+	return message
+}
+
+// shownStatus is the status an online user picked, or away if the user picked online but is inactive.
+func shownStatus(status models.UserStatus, away bool) string {
+	if away && status.GetStatus() == PresenceOnline {
+		return PresenceAway
+	}
+
+	return status.GetStatus()
+}
+
+func (server *WsServer) presenceUser(userID string) models.User {
+	user := server.FindUserById(userID)
+	if user == nil {
+		user = server.auth.NewUser(userID, "")
+	}
+
+	return user
+}
+
+func (server *WsServer) publishPresence(message *Message) {
+	if err := server.redis.Publish(ctx, PubSubGeneralChannel, message.encode()).Err(); err != nil {
+		log.Println(err)
+	}
+}
+
+// handlePresenceChanged hands the event to Run, which owns the clients and stops sending
+// to them before they disconnect.
+func (server *WsServer) handlePresenceChanged(message Message) {
+	server.broadcast <- message.encode()
+}
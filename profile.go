@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nagohak/chat-app/dto"
+)
+
+// UserUpdated sends the profile of the user to every room the user is a member of.
+// Rooms that are not running anywhere have nobody to tell and miss nothing.
+func (server *WsServer) UserUpdated(userID string) {
+	user := server.FindUserById(userID)
+	if user == nil {
+		return
+	}
+
+	profile, err := server.userRepository.FindProfile(userID)
+	if err != nil || profile == nil {
+		log.Println(err)
+		return
+	}
+
+	dbRooms, err := server.roomRepository.GetUserRooms(userID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	info := dto.NewProfileInfo(user, profile)
+	message := &Message{
+		Action:  UserUpdatedAction,
+		Sender:  user,
+		Profile: &info,
+	}
+	payload := message.encode()
+
+	for _, dbRoom := range dbRooms {
+		if err := server.redis.Publish(ctx, fmt.Sprintf(roomChannel, dbRoom.GetId()), payload).Err(); err != nil {
+			log.Println(err)
+		}
+	}
+}
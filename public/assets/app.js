@@ -19,6 +19,16 @@ var app = new Vue({
       confirmation: "",
     },
     users: [],
+    usersSummary: null,
+    profiles: {},
+    userQuery: "",
+    usersCursor: "",
+    status: {
+      status: "online",
+      statusText: "",
+      statusEmoji: ""
+    },
+    resumeToken: null,
     initialReconnectDelay: 1000,
     currentReconnectDelay: 0,
     maxReconnectDelay: 16000,
@@ -74,6 +84,18 @@ var app = new Vue({
     onWebsocketOpen() {
       console.log("connected to WS!");
       this.currentReconnectDelay = 1000;
+      this.resumeSession();
+    },
+    resumeSession() {
+      if (!this.resumeToken) {
+        return;
+      }
+
+      let acks = {};
+      for (let i = 0; i < this.rooms.length; i++) {
+        acks[this.rooms[i].id] = this.rooms[i].lastSeq || 0;
+      }
+      this.ws.send(JSON.stringify({ action: 'resume', message: this.resumeToken, acks: acks }));
     },
     onWebsocketClose() {
       this.ws = null;
@@ -100,15 +122,41 @@ var app = new Vue({
           case "send-message":
             this.handleChatMessage(msg);
             break;
-          case "user-join":
-            this.handleUserJoined(msg);
+          case "presence-changed":
+            this.handlePresenceChanged(msg);
+            break;
+          case "user-updated":
+            this.handleUserUpdated(msg);
             break;
-          case "user-left":
-            this.handleUserLeft(msg);
+          case "users-summary":
+            this.handleUsersSummary(msg);
+            break;
+          case "search-users":
+            this.handleSearchUsers(msg);
             break;
           case "room-joined":
             this.handleRoomJoined(msg);
             break;
+          case "fetch-history":
+            this.handleHistory(msg);
+            break;
+          case "message-edited":
+          case "message-deleted":
+            this.handleMessageUpdated(msg);
+            break;
+          case "session-started":
+            this.resumeToken = msg.message;
+            break;
+          case "room-updated":
+            this.handleRoomUpdated(msg);
+            break;
+          case "room-archived":
+          case "room-unarchived":
+            this.handleRoomArchived(msg);
+            break;
+          case "room-deleted":
+            this.handleRoomDeleted(msg);
+            break;
           default:
             break;
         }
@@ -119,39 +167,147 @@ var app = new Vue({
       const room = this.findRoom(msg.target.id);
       if (typeof room !== "undefined") {
         room.messages.push(msg);
+        room.lastSeq = Math.max(room.lastSeq || 0, msg.seq || 0);
       }
     },
-    handleUserJoined(msg) {
-      if (!this.userExists(msg.sender)) {
-        this.users.push(msg.sender);
+    handleMessageUpdated(msg) {
+      const room = this.findRoom(msg.target.id);
+      if (typeof room === "undefined") {
+        return;
+      }
+      for (let i = 0; i < room.messages.length; i++) {
+        if (room.messages[i].id === msg.id) {
+          room.messages[i].message = msg.message;
+          room.messages[i].editedAt = msg.editedAt;
+          room.messages[i].deleted = msg.deleted;
+        }
       }
     },
-    handleUserLeft(msg) {
+    handleRoomUpdated(msg) {
+      const room = this.findRoom(msg.target.id);
+      if (typeof room === "undefined") {
+        return;
+      }
+      // Private rooms are shown with the name of the other participant.
+      if (!room.private) {
+        room.name = msg.target.name;
+      }
+      room.topic = msg.target.topic;
+      room.description = msg.target.description;
+    },
+    handleRoomArchived(msg) {
+      const room = this.findRoom(msg.target.id);
+      if (typeof room !== "undefined") {
+        room.archived = msg.action === "room-archived";
+      }
+    },
+    handleRoomDeleted(msg) {
+      for (let i = 0; i < this.rooms.length; i++) {
+        if (this.rooms[i].id === msg.target.id) {
+          this.rooms.splice(i, 1);
+        }
+      }
+    },
+    handlePresenceChanged(msg) {
       for (let i = 0; i < this.users.length; i++) {
         if (this.users[i].id == msg.sender.id) {
-          this.users.splice(i, 1);
+          this.users.splice(i, 1, Object.assign({}, this.users[i], {
+            status: msg.status,
+            statusText: msg.statusText,
+            statusEmoji: msg.statusEmoji,
+            lastSeen: msg.lastSeen
+          }));
         }
       }
     },
+    handleUserUpdated(msg) {
+      const profile = msg.profile;
+      this.$set(this.profiles, profile.id, profile);
+      for (let i = 0; i < this.users.length; i++) {
+        if (this.users[i].id == profile.id) {
+          this.users.splice(i, 1, Object.assign({}, this.users[i], {
+            displayName: profile.displayName,
+            avatar: profile.avatar
+          }));
+        }
+      }
+    },
+    displayName(user) {
+      const profile = this.profiles[user.id];
+      return (profile && profile.displayName) || user.displayName || user.name;
+    },
+    handleUsersSummary(msg) {
+      this.usersSummary = msg.usersSummary;
+      this.searchUsers();
+    },
+    handleSearchUsers(msg) {
+      if (msg.message !== this.userQuery) {
+        return;
+      }
+      const users = msg.users || [];
+      for (let i = 0; i < users.length; i++) {
+        this.$set(this.profiles, users[i].id, users[i]);
+      }
+      this.users = this.usersCursor ? this.users.concat(users) : users;
+      this.usersCursor = msg.cursor || "";
+    },
+    searchUsers() {
+      this.usersCursor = "";
+      this.ws.send(JSON.stringify({ action: 'search-users', message: this.userQuery }));
+    },
+    moreUsers() {
+      this.ws.send(JSON.stringify({ action: 'search-users', message: this.userQuery, cursor: this.usersCursor }));
+    },
     handleRoomJoined(msg) {
+      if (typeof this.findRoom(msg.target.id) !== "undefined") {
+        return;
+      }
       room = msg.target;
-      room.name = room.private ? msg.sender.name : room.name;
+      room.name = room.private && msg.sender ? msg.sender.name : room.name;
       room["messages"] = [];
+      room["attachments"] = [];
       this.rooms.push(room);
     },
+    handleHistory(msg) {
+      const room = this.findRoom(msg.target.id);
+      if (typeof room !== "undefined") {
+        room.messages = (msg.history || []).concat(room.messages);
+      }
+    },
     sendMessage(room) {
-      if (room.newMessage !== "") {
+      if (room.newMessage !== "" || room.attachments.length > 0) {
         this.ws.send(JSON.stringify({
           action: 'send-message',
           message: room.newMessage,
           target: {
             id: room.id,
             name: room.name
-          }
+          },
+          attachments: room.attachments.map(attachment => ({ id: attachment.id }))
         }));
         room.newMessage = "";
+        room.attachments = [];
+      }
+    },
+    async uploadAttachment(room, event) {
+      const files = Array.from(event.target.files);
+      event.target.value = "";
+      for (const file of files) {
+        const form = new FormData();
+        form.append("file", file);
+        try {
+          const result = await axios.post("http://" + location.host + "/api/attachments", form, {
+            headers: { Authorization: "Bearer " + this.user.token }
+          });
+          room.attachments.push(result.data);
+        } catch (e) {
+          console.log(e);
+        }
       }
     },
+    attachmentUrl(url) {
+      return url + "?bearer=" + this.user.token;
+    },
     findRoom(roomId) {
       for (let i = 0; i < this.rooms.length; i++) {
         if (this.rooms[i].id === roomId) {
@@ -176,6 +332,14 @@ var app = new Vue({
     joinPrivateRoom(room) {
       this.ws.send(JSON.stringify({ action: 'join-room-private', message: room.id }));
     },
+    setStatus() {
+      this.ws.send(JSON.stringify({
+        action: 'set-status',
+        status: this.status.status,
+        statusText: this.status.statusText,
+        statusEmoji: this.status.statusEmoji
+      }));
+    },
     userExists(user) {
       for (let i = 0; i < this.users.length; i++) {
         if (this.users[i].id == user.id) {
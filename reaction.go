@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"unicode/utf8"
+)
+
+// Maximum length of a reaction emoji, enough for joined emoji sequences
+const maxEmojiLength = 16
+
+func (client *Client) handleReactionMessage(message Message) {
+	emoji := message.Message
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return
+	}
+
+	room, dbMessage := client.findRoomMessage(message)
+	if dbMessage == nil || dbMessage.GetDeleted() || room.GetArchived() {
+		return
+	}
+
+	// Muted users can take their reactions back but not add new ones.
+	if message.Action == AddReactionAction && client.isMuted(room) {
+		client.sendError(room, mutedMessage)
+		return
+	}
+
+	repository := client.wsServer.reactionRepository
+
+	var err error
+	if message.Action == AddReactionAction {
+		err = repository.AddReaction(dbMessage.GetId(), client.GetID(), emoji)
+	} else {
+		err = repository.RemoveReaction(dbMessage.GetId(), client.GetID(), emoji)
+	}
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	counts, err := repository.GetReactionCounts([]string{dbMessage.GetId()})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	room.publishRoomMessage(&Message{
+		ID:        dbMessage.GetId(),
+		Action:    ReactionsUpdatedAction,
+		Message:   emoji,
+		Target:    room,
+		Sender:    client,
+		Seq:       dbMessage.GetSeq(),
+		ReplyTo:   dbMessage.GetReplyTo(),
+		Reactions: counts[dbMessage.GetId()],
+	})
+}
+
+// attachReactions adds the reaction summary to each of the given messages.
+func (server *WsServer) attachReactions(messages []*Message) {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	counts, err := server.reactionRepository.GetReactionCounts(ids)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, message := range messages {
+		message.Reactions = counts[message.ID]
+	}
+}
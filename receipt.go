@@ -0,0 +1,89 @@
+package main
+
+import "log"
+
+func (client *Client) handleMarkReadMessage(message Message) {
+	if message.Target == nil || message.Seq <= 0 {
+		return
+	}
+
+	room := client.wsServer.findRoomByID(message.Target.GetId())
+	if room == nil || !client.isInRoom(room) {
+		return
+	}
+
+	// Receipts cannot run ahead of the room, that would hide messages not sent yet.
+	lastSeq, err := room.lastSeq()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if message.Seq > lastSeq {
+		message.Seq = lastSeq
+	}
+	if message.Seq <= 0 {
+		return
+	}
+
+	if err := client.wsServer.receiptRepository.MarkRead(client.GetID(), room.GetId(), message.Seq); err != nil {
+		log.Println(err)
+		return
+	}
+
+	// Let the other members, and the other clients of this user, know how far the user has read.
+	room.publishRoomMessage(&Message{
+		Action: ReadReceiptAction,
+		Target: room,
+		Sender: client,
+		Seq:    message.Seq,
+	})
+}
+
+// handleFetchReceiptsMessage sends up to which sequence number each member has read the room.
+func (client *Client) handleFetchReceiptsMessage(message Message) {
+	if message.Target == nil {
+		return
+	}
+
+	room := client.wsServer.findRoomByID(message.Target.GetId())
+	if room == nil || !client.isInRoom(room) {
+		return
+	}
+
+	receipts, err := client.wsServer.receiptRepository.GetRoomReceipts(room.GetId())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	client.send <- (&Message{
+		Action:   FetchReceiptsAction,
+		Target:   room,
+		Receipts: receipts,
+	}).encode()
+}
+
+func (client *Client) unreadCount(room *Room) int {
+	count, err := client.wsServer.receiptRepository.GetUnreadCount(client.GetID(), room.GetId())
+	if err != nil {
+		log.Println(err)
+	}
+
+	return count
+}
+
+// listUnreadCounts sends the unread count of each room the user is a member of.
+func (server *WsServer) listUnreadCounts(client *Client) {
+	counts, err := server.receiptRepository.GetUnreadCounts(client.GetID())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	message := &Message{
+		Action: UnreadCountsAction,
+		Unread: counts,
+	}
+
+	client.send <- message.encode()
+}
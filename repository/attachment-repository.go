@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/nagohak/chat-app/models"
+)
+
+const attachmentColumns = "id, uploader_id, COALESCE(room_id, ''), COALESCE(message_id, ''), name, mime_type, size, thumbnail"
+
+type Attachment struct {
+	Id         string
+	UploaderId string
+	RoomId     string
+	MessageId  string
+	Name       string
+	MimeType   string
+	Size       int64
+	Thumbnail  bool
+}
+
+func (attachment *Attachment) GetId() string {
+	return attachment.Id
+}
+
+func (attachment *Attachment) GetUploaderId() string {
+	return attachment.UploaderId
+}
+
+func (attachment *Attachment) GetRoomId() string {
+	return attachment.RoomId
+}
+
+func (attachment *Attachment) GetMessageId() string {
+	return attachment.MessageId
+}
+
+func (attachment *Attachment) GetName() string {
+	return attachment.Name
+}
+
+func (attachment *Attachment) GetMimeType() string {
+	return attachment.MimeType
+}
+
+func (attachment *Attachment) GetSize() int64 {
+	return attachment.Size
+}
+
+func (attachment *Attachment) GetThumbnail() bool {
+	return attachment.Thumbnail
+}
+
+type attachmentRepository struct {
+	db *sql.DB
+}
+
+func NewAttachmentRepository(db *sql.DB) models.AttachmentRepository {
+	return &attachmentRepository{db: db}
+}
+
+func (repo *attachmentRepository) AddAttachment(id string, uploaderId string, name string, mimeType string, size int64, thumbnail bool) error {
+	stmt, err := repo.db.Prepare(`INSERT INTO attachments(id, uploader_id, name, mime_type, size, thumbnail)
+		values ($1, $2, $3, $4, $5, $6)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(id, uploaderId, name, mimeType, size, thumbnail)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *attachmentRepository) FindAttachment(id string) (models.Attachment, error) {
+	row := repo.db.QueryRow("SELECT "+attachmentColumns+" FROM attachments WHERE id = $1", id)
+
+	attachment, err := scanAttachment(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+func (repo *attachmentRepository) AttachToMessage(ids []string, uploaderId string, roomId string, messageId string) ([]models.Attachment, error) {
+	rows, err := repo.db.Query(`UPDATE attachments SET room_id = $3, message_id = $4
+		WHERE id = ANY($1) AND uploader_id = $2 AND message_id IS NULL
+		RETURNING `+attachmentColumns, pq.Array(ids), uploaderId, roomId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, rows.Err()
+}
+
+func (repo *attachmentRepository) GetMessageAttachments(messageIds []string) (map[string][]models.Attachment, error) {
+	rows, err := repo.db.Query("SELECT "+attachmentColumns+` FROM attachments
+		WHERE message_id = ANY($1) ORDER BY created_at, id`, pq.Array(messageIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make(map[string][]models.Attachment)
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments[attachment.MessageId] = append(attachments[attachment.MessageId], attachment)
+	}
+
+	return attachments, rows.Err()
+}
+
+func (repo *attachmentRepository) DeleteMessageAttachments(messageId string) ([]string, error) {
+	rows, err := repo.db.Query("DELETE FROM attachments WHERE message_id = $1 RETURNING id", messageId)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachmentIds(rows)
+}
+
+func (repo *attachmentRepository) DeleteRoomAttachments(roomId string) ([]string, error) {
+	rows, err := repo.db.Query("DELETE FROM attachments WHERE room_id = $1 RETURNING id", roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachmentIds(rows)
+}
+
+func scanAttachmentIds(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func scanAttachment(row rowScanner) (*Attachment, error) {
+	var attachment Attachment
+
+	if err := row.Scan(&attachment.Id, &attachment.UploaderId, &attachment.RoomId, &attachment.MessageId,
+		&attachment.Name, &attachment.MimeType, &attachment.Size, &attachment.Thumbnail); err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/nagohak/chat-app/models"
+)
+
+type Invite struct {
+	Id     string
+	RoomId string
+	Role   string
+}
+
+func (invite *Invite) GetId() string {
+	return invite.Id
+}
+
+func (invite *Invite) GetRoomId() string {
+	return invite.RoomId
+}
+
+func (invite *Invite) GetRole() string {
+	return invite.Role
+}
+
+type inviteRepository struct {
+	db *sql.DB
+}
+
+func NewInviteRepository(db *sql.DB) models.InviteRepository {
+	return &inviteRepository{db: db}
+}
+
+func (repo *inviteRepository) AddInvite(id string, roomId string, createdBy string, role string, maxUses int, expiresAt time.Time) error {
+	stmt, err := repo.db.Prepare(`INSERT INTO room_invites(id, room_id, created_by, role, max_uses, expires_at)
+		values ($1, $2, $3, $4, $5, $6)`)
+	if err != nil {
+		return err
+	}
+
+	expires := sql.NullTime{Time: expiresAt, Valid: !expiresAt.IsZero()}
+
+	_, err = stmt.Exec(id, roomId, createdBy, role, maxUses, expires)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *inviteRepository) UseInvite(id string) (models.Invite, error) {
+	row := repo.db.QueryRow(`UPDATE room_invites SET uses = uses + 1
+		WHERE id = $1 AND (max_uses = 0 OR uses < max_uses) AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING id, room_id, role`, id)
+
+	var invite Invite
+
+	if err := row.Scan(&invite.Id, &invite.RoomId, &invite.Role); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &invite, nil
+}
@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nagohak/chat-app/models"
+)
+
+type Message struct {
+	Id         string
+	RoomId     string
+	SenderId   string
+	SenderName string
+	Message    string
+	CreatedAt  time.Time
+	Seq        int64
+	EditedAt   sql.NullTime
+	DeletedAt  sql.NullTime
+	ReplyTo    sql.NullString
+}
+
+const messageColumns = "id, room_id, sender_id, sender_name, message, created_at, seq, edited_at, deleted_at, reply_to"
+
+func (message *Message) GetId() string {
+	return message.Id
+}
+
+func (message *Message) GetRoomId() string {
+	return message.RoomId
+}
+
+func (message *Message) GetSender() models.User {
+	return &User{Id: message.SenderId, Name: message.SenderName}
+}
+
+func (message *Message) GetMessage() string {
+	return message.Message
+}
+
+func (message *Message) GetCreatedAt() time.Time {
+	return message.CreatedAt
+}
+
+func (message *Message) GetSeq() int64 {
+	return message.Seq
+}
+
+func (message *Message) GetEditedAt() time.Time {
+	return message.EditedAt.Time
+}
+
+func (message *Message) GetDeleted() bool {
+	return message.DeletedAt.Valid
+}
+
+func (message *Message) GetReplyTo() string {
+	return message.ReplyTo.String
+}
+
+type messageRepository struct {
+	db *sql.DB
+}
+
+func NewMessageRepository(db *sql.DB) models.MessageRepository {
+	return &messageRepository{db: db}
+}
+
+func (repo *messageRepository) AddMessage(message models.Message) error {
+	stmt, err := repo.db.Prepare("INSERT INTO messages(id, room_id, sender_id, sender_name, message, created_at, seq, reply_to) values ($1, $2, $3, $4, $5, $6, $7, $8)")
+	if err != nil {
+		return err
+	}
+
+	sender := message.GetSender()
+	replyTo := sql.NullString{String: message.GetReplyTo(), Valid: message.GetReplyTo() != ""}
+
+	_, err = stmt.Exec(message.GetId(), message.GetRoomId(), sender.GetID(), sender.GetName(), message.GetMessage(), message.GetCreatedAt(), message.GetSeq(), replyTo)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetRoomMessages returns up to limit top level messages of the room with a sequence number
+// lower than beforeSeq, oldest first. A zero beforeSeq means "from the latest message".
+func (repo *messageRepository) GetRoomMessages(roomId string, beforeSeq int64, limit int) ([]models.Message, error) {
+	var rows *sql.Rows
+	var err error
+
+	query := `SELECT ` + messageColumns + ` FROM (
+		SELECT * FROM messages WHERE room_id = $1 AND reply_to IS NULL %s ORDER BY seq DESC LIMIT $2
+	) AS page ORDER BY seq ASC`
+
+	if beforeSeq > 0 {
+		rows, err = repo.db.Query(fmt.Sprintf(query, "AND seq < $3"), roomId, limit, beforeSeq)
+	} else {
+		rows, err = repo.db.Query(fmt.Sprintf(query, ""), roomId, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// GetRoomMessagesAfter returns up to limit top level messages of the room with a sequence
+// number greater than afterSeq, oldest first.
+func (repo *messageRepository) GetRoomMessagesAfter(roomId string, afterSeq int64, limit int) ([]models.Message, error) {
+	rows, err := repo.db.Query(`SELECT `+messageColumns+` FROM messages
+		WHERE room_id = $1 AND reply_to IS NULL AND seq > $2 ORDER BY seq ASC LIMIT $3`, roomId, afterSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// GetThreadMessages returns up to limit replies to the given message with a sequence number
+// lower than beforeSeq, oldest first. A zero beforeSeq means "from the latest reply".
+func (repo *messageRepository) GetThreadMessages(parentId string, beforeSeq int64, limit int) ([]models.Message, error) {
+	var rows *sql.Rows
+	var err error
+
+	query := `SELECT ` + messageColumns + ` FROM (
+		SELECT * FROM messages WHERE reply_to = $1 %s ORDER BY seq DESC LIMIT $2
+	) AS page ORDER BY seq ASC`
+
+	if beforeSeq > 0 {
+		rows, err = repo.db.Query(fmt.Sprintf(query, "AND seq < $3"), parentId, limit, beforeSeq)
+	} else {
+		rows, err = repo.db.Query(fmt.Sprintf(query, ""), parentId, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+func (repo *messageRepository) AddThreadParticipant(messageId string, userId string) error {
+	stmt, err := repo.db.Prepare("INSERT INTO thread_participants(message_id, user_id) values ($1, $2) ON CONFLICT DO NOTHING")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(messageId, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *messageRepository) RemoveThreadParticipant(messageId string, userId string) error {
+	stmt, err := repo.db.Prepare("DELETE FROM thread_participants WHERE message_id = $1 AND user_id = $2")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(messageId, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *messageRepository) GetThreadParticipants(messageId string) ([]string, error) {
+	rows, err := repo.db.Query("SELECT user_id FROM thread_participants WHERE message_id = $1", messageId)
+	if err != nil {
+		return nil, err
+	}
+
+	var userIds []string
+	defer rows.Close()
+
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		userIds = append(userIds, userId)
+	}
+
+	return userIds, rows.Err()
+}
+
+func (repo *messageRepository) FindMessageById(id string) (models.Message, error) {
+	row := repo.db.QueryRow("SELECT "+messageColumns+" FROM messages WHERE id = $1 LIMIT 1", id)
+
+	message, err := scanMessage(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return message, nil
+}
+
+func (repo *messageRepository) EditMessage(id string, text string, editedAt time.Time) error {
+	stmt, err := repo.db.Prepare("UPDATE messages SET message = $2, edited_at = $3 WHERE id = $1 AND deleted_at IS NULL")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(id, text, editedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteMessage keeps the row as a tombstone so replies and history stay consistent.
+func (repo *messageRepository) DeleteMessage(id string, deletedAt time.Time) error {
+	stmt, err := repo.db.Prepare("UPDATE messages SET message = '', deleted_at = $2 WHERE id = $1")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(id, deletedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *messageRepository) GetLastSeq(roomId string) (int64, error) {
+	row := repo.db.QueryRow("SELECT COALESCE(MAX(seq), 0) FROM messages WHERE room_id = $1", roomId)
+
+	var seq int64
+	if err := row.Scan(&seq); err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(row rowScanner) (*Message, error) {
+	var message Message
+
+	err := row.Scan(&message.Id, &message.RoomId, &message.SenderId, &message.SenderName, &message.Message,
+		&message.CreatedAt, &message.Seq, &message.EditedAt, &message.DeletedAt, &message.ReplyTo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+func scanMessages(rows *sql.Rows) ([]models.Message, error) {
+	var messages []models.Message
+	defer rows.Close()
+
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
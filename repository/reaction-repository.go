@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/nagohak/chat-app/models"
+)
+
+type reactionRepository struct {
+	db *sql.DB
+}
+
+func NewReactionRepository(db *sql.DB) models.ReactionRepository {
+	return &reactionRepository{db: db}
+}
+
+func (repo *reactionRepository) AddReaction(messageId string, userId string, emoji string) error {
+	stmt, err := repo.db.Prepare("INSERT INTO reactions(message_id, user_id, emoji) values ($1, $2, $3) ON CONFLICT DO NOTHING")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(messageId, userId, emoji)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *reactionRepository) RemoveReaction(messageId string, userId string, emoji string) error {
+	stmt, err := repo.db.Prepare("DELETE FROM reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(messageId, userId, emoji)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *reactionRepository) GetReactionCounts(messageIds []string) (map[string]map[string]int, error) {
+	counts := make(map[string]map[string]int)
+	if len(messageIds) == 0 {
+		return counts, nil
+	}
+
+	rows, err := repo.db.Query(`SELECT message_id, emoji, COUNT(*) FROM reactions
+		WHERE message_id = ANY($1) GROUP BY message_id, emoji`, pq.Array(messageIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageId, emoji string
+		var count int
+		if err := rows.Scan(&messageId, &emoji, &count); err != nil {
+			return nil, err
+		}
+
+		if counts[messageId] == nil {
+			counts[messageId] = make(map[string]int)
+		}
+		counts[messageId][emoji] = count
+	}
+
+	return counts, rows.Err()
+}
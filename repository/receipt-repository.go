@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/nagohak/chat-app/models"
+)
+
+type receiptRepository struct {
+	db *sql.DB
+}
+
+func NewReceiptRepository(db *sql.DB) models.ReceiptRepository {
+	return &receiptRepository{db: db}
+}
+
+func (repo *receiptRepository) MarkRead(userId string, roomId string, seq int64) error {
+	stmt, err := repo.db.Prepare(`INSERT INTO read_receipts(user_id, room_id, last_read_seq) values ($1, $2, $3)
+		ON CONFLICT (user_id, room_id) DO UPDATE
+		SET last_read_seq = GREATEST(read_receipts.last_read_seq, EXCLUDED.last_read_seq), updated_at = NOW()`)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(userId, roomId, seq)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *receiptRepository) GetRoomReceipts(roomId string) (map[string]int64, error) {
+	rows, err := repo.db.Query("SELECT user_id, last_read_seq FROM read_receipts WHERE room_id = $1", roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipts := make(map[string]int64)
+	for rows.Next() {
+		var userId string
+		var seq int64
+		if err := rows.Scan(&userId, &seq); err != nil {
+			return nil, err
+		}
+		receipts[userId] = seq
+	}
+
+	return receipts, rows.Err()
+}
+
+func (repo *receiptRepository) GetUnreadCount(userId string, roomId string) (int, error) {
+	row := repo.db.QueryRow(`SELECT COUNT(*) FROM messages m
+		WHERE m.room_id = $2 AND m.sender_id <> $1 AND m.reply_to IS NULL AND m.deleted_at IS NULL
+		AND m.seq > COALESCE((SELECT last_read_seq FROM read_receipts WHERE user_id = $1 AND room_id = $2), 0)`, userId, roomId)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (repo *receiptRepository) GetUnreadCounts(userId string) (map[string]int, error) {
+	// Rooms without a receipt count from the start.
+	rows, err := repo.db.Query(`SELECT rm.room_id, COUNT(m.id) FROM room_members rm
+		LEFT JOIN read_receipts r ON r.room_id = rm.room_id AND r.user_id = rm.user_id
+		LEFT JOIN messages m ON m.room_id = rm.room_id AND m.seq > COALESCE(r.last_read_seq, 0)
+			AND m.sender_id <> rm.user_id AND m.reply_to IS NULL AND m.deleted_at IS NULL
+		WHERE rm.user_id = $1 GROUP BY rm.room_id`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var roomId string
+		var count int
+		if err := rows.Scan(&roomId, &count); err != nil {
+			return nil, err
+		}
+		counts[roomId] = count
+	}
+
+	return counts, rows.Err()
+}
@@ -2,14 +2,19 @@ package repository
 
 import (
 	"database/sql"
+	"strings"
+	"time"
 
 	"github.com/nagohak/chat-app/models"
 )
 
 type Room struct {
-	Id      string
-	Name    string
-	Private bool
+	Id          string
+	Name        string
+	Private     bool
+	Topic       string
+	Description string
+	Archived    bool
 }
 
 func (room *Room) GetId() string {
@@ -24,6 +29,43 @@ func (room *Room) GetPrivate() bool {
 	return room.Private
 }
 
+func (room *Room) GetTopic() string {
+	return room.Topic
+}
+
+func (room *Room) GetDescription() string {
+	return room.Description
+}
+
+func (room *Room) GetArchived() bool {
+	return room.Archived
+}
+
+type RoomSummary struct {
+	Room
+	MemberCount  int
+	LastActivity sql.NullTime
+}
+
+func (room *RoomSummary) GetMemberCount() int {
+	return room.MemberCount
+}
+
+func (room *RoomSummary) GetLastActivity() time.Time {
+	return room.LastActivity.Time
+}
+
+type DirectRoom struct {
+	Room
+	Peer User
+}
+
+func (room *DirectRoom) GetPeer() models.User {
+	return &room.Peer
+}
+
+const roomColumns = "r.id, r.name, r.private, r.topic, r.description, r.archived_at IS NOT NULL"
+
 type roomRepository struct {
 	db *sql.DB
 }
@@ -33,12 +75,12 @@ func NewRoomRepository(db *sql.DB) models.RoomRepository {
 }
 
 func (repo *roomRepository) AddRoom(room models.Room) error {
-	stmt, err := repo.db.Prepare("INSERT INTO rooms(id, name, private) values ($1,$2,$3)")
+	stmt, err := repo.db.Prepare("INSERT INTO rooms(id, name, private, topic, description) values ($1,$2,$3,$4,$5)")
 	if err != nil {
 		return err
 	}
 
-	_, err = stmt.Exec(room.GetId(), room.GetName(), room.GetPrivate())
+	_, err = stmt.Exec(room.GetId(), room.GetName(), room.GetPrivate(), room.GetTopic(), room.GetDescription())
 	if err != nil {
 		return err
 	}
@@ -47,11 +89,151 @@ func (repo *roomRepository) AddRoom(room models.Room) error {
 }
 
 func (repo *roomRepository) FindRoomByName(name string) (models.Room, error) {
-	row := repo.db.QueryRow("SELECT id, name, private FROM rooms WHERE name = $1 LIMIT 1", name)
+	row := repo.db.QueryRow("SELECT "+roomColumns+" FROM rooms r WHERE r.name = $1 LIMIT 1", name)
+
+	return scanRoom(row)
+}
+
+func (repo *roomRepository) FindRoomById(id string) (models.Room, error) {
+	row := repo.db.QueryRow("SELECT "+roomColumns+" FROM rooms r WHERE r.id = $1 LIMIT 1", id)
+
+	return scanRoom(row)
+}
+
+func (repo *roomRepository) SearchRooms(query string, limit int, offset int) ([]models.Room, error) {
+	rows, err := repo.db.Query("SELECT "+roomColumns+" FROM rooms r WHERE r.name ILIKE $1 ORDER BY r.name, r.id LIMIT $2 OFFSET $3",
+		"%"+query+"%", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRooms(rows)
+}
 
+func (repo *roomRepository) ListPublicRooms(prefix string, limit int, offset int) ([]models.RoomSummary, error) {
+	rows, err := repo.db.Query(`SELECT `+roomColumns+`,
+		(SELECT COUNT(*) FROM room_members m WHERE m.room_id = r.id),
+		(SELECT MAX(created_at) FROM messages WHERE room_id = r.id)
+		FROM rooms r
+		WHERE r.private IS NOT TRUE AND r.archived_at IS NULL AND lower(r.name) LIKE $1
+		ORDER BY lower(r.name), r.id LIMIT $2 OFFSET $3`,
+		likePrefix(strings.ToLower(prefix)), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []models.RoomSummary
+	for rows.Next() {
+		var room RoomSummary
+		if err := rows.Scan(&room.Id, &room.Name, &room.Private, &room.Topic, &room.Description, &room.Archived, &room.MemberCount, &room.LastActivity); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, &room)
+	}
+
+	return rooms, rows.Err()
+}
+
+// likePrefix turns the prefix into a LIKE pattern, matching its wildcards literally.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
+
+func (repo *roomRepository) UpdateRoom(id string, topic string, description string) error {
+	stmt, err := repo.db.Prepare("UPDATE rooms SET topic = $2, description = $3 WHERE id = $1")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(id, topic, description)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *roomRepository) RenameRoom(id string, name string, renamedBy string) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO room_renames(room_id, old_name, new_name, renamed_by)
+		SELECT id, name, $2, $3 FROM rooms WHERE id = $1`, id, name, renamedBy); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE rooms SET name = $2 WHERE id = $1", id, name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repo *roomRepository) SetRoomArchived(id string, archived bool) error {
+	stmt, err := repo.db.Prepare("UPDATE rooms SET archived_at = CASE WHEN $2 THEN NOW() ELSE NULL END WHERE id = $1")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(id, archived)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *roomRepository) DeleteRoom(id string) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		"DELETE FROM reactions WHERE message_id IN (SELECT id FROM messages WHERE room_id = $1)",
+		"DELETE FROM thread_participants WHERE message_id IN (SELECT id FROM messages WHERE room_id = $1)",
+		"DELETE FROM messages WHERE room_id = $1",
+		"DELETE FROM read_receipts WHERE room_id = $1",
+		"DELETE FROM room_sanctions WHERE room_id = $1",
+		"DELETE FROM room_members WHERE room_id = $1",
+		"DELETE FROM room_renames WHERE room_id = $1",
+		"DELETE FROM room_invites WHERE room_id = $1",
+		"DELETE FROM direct_rooms WHERE room_id = $1",
+		"DELETE FROM rooms WHERE id = $1",
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func scanRooms(rows *sql.Rows) ([]models.Room, error) {
+	var rooms []models.Room
+	defer rows.Close()
+
+	for rows.Next() {
+		var room Room
+		if err := rows.Scan(&room.Id, &room.Name, &room.Private, &room.Topic, &room.Description, &room.Archived); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, &room)
+	}
+
+	return rooms, rows.Err()
+}
+
+func scanRoom(row rowScanner) (models.Room, error) {
 	var room Room
 
-	if err := row.Scan(&room.Id, &room.Name, &room.Private); err != nil {
+	if err := row.Scan(&room.Id, &room.Name, &room.Private, &room.Topic, &room.Description, &room.Archived); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -60,3 +242,225 @@ func (repo *roomRepository) FindRoomByName(name string) (models.Room, error) {
 
 	return &room, nil
 }
+
+// orderedPair sorts the user IDs so a conversation is stored once for both directions.
+func orderedPair(userA string, userB string) (string, string) {
+	if userA > userB {
+		return userB, userA
+	}
+	return userA, userB
+}
+
+func (repo *roomRepository) AddDirectRoom(roomId string, userA string, userB string) error {
+	stmt, err := repo.db.Prepare("INSERT INTO direct_rooms(room_id, user_a, user_b) values ($1, $2, $3)")
+	if err != nil {
+		return err
+	}
+
+	userA, userB = orderedPair(userA, userB)
+
+	_, err = stmt.Exec(roomId, userA, userB)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *roomRepository) FindDirectRoom(userA string, userB string) (models.Room, error) {
+	userA, userB = orderedPair(userA, userB)
+
+	row := repo.db.QueryRow(`SELECT `+roomColumns+` FROM direct_rooms d
+		JOIN rooms r ON r.id = d.room_id WHERE d.user_a = $1 AND d.user_b = $2 LIMIT 1`, userA, userB)
+
+	return scanRoom(row)
+}
+
+func (repo *roomRepository) GetDirectRooms(userId string) ([]models.DirectRoom, error) {
+	rows, err := repo.db.Query(`SELECT `+roomColumns+`, u.id, u.name FROM direct_rooms d
+		JOIN rooms r ON r.id = d.room_id
+		JOIN users u ON u.id = CASE WHEN d.user_a = $1 THEN d.user_b ELSE d.user_a END
+		WHERE d.user_a = $1 OR d.user_b = $1`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var rooms []models.DirectRoom
+	defer rows.Close()
+
+	for rows.Next() {
+		var room DirectRoom
+		if err := rows.Scan(&room.Id, &room.Name, &room.Private, &room.Topic, &room.Description, &room.Archived, &room.Peer.Id, &room.Peer.Name); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, &room)
+	}
+
+	return rooms, rows.Err()
+}
+
+func (repo *roomRepository) AddRoomMember(roomId string, userId string, role string) error {
+	stmt, err := repo.db.Prepare("INSERT INTO room_members(room_id, user_id, role) values ($1, $2, $3) ON CONFLICT DO NOTHING")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(roomId, userId, role)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *roomRepository) AddRoomMembers(roomId string, userIds []string, role string) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("INSERT INTO room_members(room_id, user_id, role) values ($1, $2, $3) ON CONFLICT DO NOTHING")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, userId := range userIds {
+		if _, err := stmt.Exec(roomId, userId, role); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repo *roomRepository) RemoveRoomMember(roomId string, userId string) error {
+	stmt, err := repo.db.Prepare("DELETE FROM room_members WHERE room_id = $1 AND user_id = $2")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(roomId, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *roomRepository) IsRoomMember(roomId string, userId string) (bool, error) {
+	row := repo.db.QueryRow("SELECT EXISTS(SELECT 1 FROM room_members WHERE room_id = $1 AND user_id = $2)", roomId, userId)
+
+	var member bool
+	if err := row.Scan(&member); err != nil {
+		return false, err
+	}
+
+	return member, nil
+}
+
+func (repo *roomRepository) GetRoomMemberIds(roomId string) ([]string, error) {
+	rows, err := repo.db.Query("SELECT user_id FROM room_members WHERE room_id = $1", roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (repo *roomRepository) GetRoomRole(roomId string, userId string) (string, error) {
+	row := repo.db.QueryRow("SELECT role FROM room_members WHERE room_id = $1 AND user_id = $2", roomId, userId)
+
+	var role string
+	if err := row.Scan(&role); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return role, nil
+}
+
+func (repo *roomRepository) SetRoomRole(roomId string, userId string, role string) error {
+	stmt, err := repo.db.Prepare("UPDATE room_members SET role = $3 WHERE room_id = $1 AND user_id = $2")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(roomId, userId, role)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *roomRepository) GetUserRooms(userId string) ([]models.Room, error) {
+	rows, err := repo.db.Query(`SELECT `+roomColumns+` FROM room_members m
+		JOIN rooms r ON r.id = m.room_id WHERE m.user_id = $1 ORDER BY m.created_at`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRooms(rows)
+}
+
+func (repo *roomRepository) AddSanction(roomId string, userId string, kind string, createdBy string, expiresAt time.Time) error {
+	stmt, err := repo.db.Prepare(`INSERT INTO room_sanctions(room_id, user_id, kind, created_by, expires_at) values ($1, $2, $3, $4, $5)
+		ON CONFLICT (room_id, user_id, kind) DO UPDATE
+		SET created_by = EXCLUDED.created_by, created_at = NOW(), expires_at = EXCLUDED.expires_at`)
+	if err != nil {
+		return err
+	}
+
+	expires := sql.NullTime{Time: expiresAt, Valid: !expiresAt.IsZero()}
+
+	_, err = stmt.Exec(roomId, userId, kind, createdBy, expires)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *roomRepository) RemoveSanction(roomId string, userId string, kind string) error {
+	stmt, err := repo.db.Prepare("DELETE FROM room_sanctions WHERE room_id = $1 AND user_id = $2 AND kind = $3")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(roomId, userId, kind)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *roomRepository) GetSanction(roomId string, userId string, kind string) (bool, time.Time, error) {
+	row := repo.db.QueryRow(`SELECT expires_at FROM room_sanctions
+		WHERE room_id = $1 AND user_id = $2 AND kind = $3 AND (expires_at IS NULL OR expires_at > NOW())`, roomId, userId, kind)
+
+	var expiresAt sql.NullTime
+	if err := row.Scan(&expiresAt); err != nil {
+		if err == sql.ErrNoRows {
+			return false, time.Time{}, nil
+		}
+		return false, time.Time{}, err
+	}
+
+	return true, expiresAt.Time, nil
+}
@@ -2,8 +2,11 @@ package repository
 
 import (
 	"database/sql"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/nagohak/chat-app/models"
 )
 
@@ -12,6 +15,8 @@ type User struct {
 	Name     string `json:"name"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Admin    bool   `json:"admin"`
+	Disabled bool   `json:"disabled"`
 }
 
 func (user *User) GetID() string {
@@ -30,6 +35,66 @@ func (user *User) GetPassword() string {
 	return user.Password
 }
 
+func (user *User) GetAdmin() bool {
+	return user.Admin
+}
+
+func (user *User) GetDisabled() bool {
+	return user.Disabled
+}
+
+type UserStatus struct {
+	Status string `json:"status"`
+	Text   string `json:"text"`
+	Emoji  string `json:"emoji"`
+}
+
+func (status *UserStatus) GetStatus() string {
+	return status.Status
+}
+
+func (status *UserStatus) GetStatusText() string {
+	return status.Text
+}
+
+func (status *UserStatus) GetStatusEmoji() string {
+	return status.Emoji
+}
+
+type Profile struct {
+	DisplayName string `json:"displayName"`
+	Bio         string `json:"bio"`
+	Timezone    string `json:"timezone"`
+	Avatar      string `json:"avatar"`
+}
+
+func (profile *Profile) GetDisplayName() string {
+	return profile.DisplayName
+}
+
+func (profile *Profile) GetBio() string {
+	return profile.Bio
+}
+
+func (profile *Profile) GetTimezone() string {
+	return profile.Timezone
+}
+
+func (profile *Profile) GetAvatar() string {
+	return profile.Avatar
+}
+
+type UserSummary struct {
+	User
+	UserStatus
+	Profile
+	LastSeen sql.NullTime
+}
+
+func (user *UserSummary) GetLastSeen() time.Time {
+	return user.LastSeen.Time
+}
+
 type userRepository struct {
 	db *sql.DB
 }
@@ -88,7 +153,7 @@ func (repo *userRepository) RemoveUser(user models.User) error {
 }
 
 func (repo *userRepository) FindUserById(id string) (models.User, error) {
-	row := repo.db.QueryRow("SELECT id, name FROM users WHERE id = $1")
+	row := repo.db.QueryRow("SELECT id, name FROM users WHERE id = $1", id)
 
 	var user User
 
@@ -104,11 +169,11 @@ func (repo *userRepository) FindUserById(id string) (models.User, error) {
 }
 
 func (repo *userRepository) FindUserByUsername(username string) (models.DbUser, error) {
-	row := repo.db.QueryRow("SELECT id, name, username, password FROM users WHERE username = $1 LIMIT 1", username)
+	row := repo.db.QueryRow("SELECT id, name, COALESCE(username, ''), COALESCE(password, ''), admin, disabled FROM users WHERE username = $1 LIMIT 1", username)
 
 	var user User
 
-	if err := row.Scan(&user.Id, &user.Name, &user.Username, &user.Password); err != nil {
+	if err := row.Scan(&user.Id, &user.Name, &user.Username, &user.Password, &user.Admin, &user.Disabled); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -135,3 +200,179 @@ func (repo *userRepository) GetAllUsers() ([]models.User, error) {
 
 	return users, nil
 }
+
+func (repo *userRepository) FindDbUserById(id string) (models.DbUser, error) {
+	row := repo.db.QueryRow("SELECT id, name, COALESCE(username, ''), COALESCE(password, ''), admin, disabled FROM users WHERE id = $1 LIMIT 1", id)
+
+	var user User
+
+	if err := row.Scan(&user.Id, &user.Name, &user.Username, &user.Password, &user.Admin, &user.Disabled); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (repo *userRepository) SearchUsers(query string, limit int, offset int) ([]models.DbUser, error) {
+	rows, err := repo.db.Query(`SELECT id, name, COALESCE(username, ''), admin, disabled FROM users
+		WHERE name ILIKE $1 OR username ILIKE $1 ORDER BY name, id LIMIT $2 OFFSET $3`, "%"+query+"%", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.DbUser
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.Id, &user.Name, &user.Username, &user.Admin, &user.Disabled); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+func (repo *userRepository) SetUserDisabled(id string, disabled bool) error {
+	stmt, err := repo.db.Prepare("UPDATE users SET disabled = $2 WHERE id = $1")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(id, disabled)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *userRepository) SetUserStatus(id string, status, text, emoji string) error {
+	stmt, err := repo.db.Prepare("UPDATE users SET status = $2, status_text = $3, status_emoji = $4 WHERE id = $1")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(id, status, text, emoji)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *userRepository) GetUserStatuses(ids []string) (map[string]models.UserStatus, error) {
+	rows, err := repo.db.Query("SELECT id, status, status_text, status_emoji FROM users WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]models.UserStatus)
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var status UserStatus
+		if err := rows.Scan(&id, &status.Status, &status.Text, &status.Emoji); err != nil {
+			return nil, err
+		}
+		statuses[id] = &status
+	}
+
+	return statuses, rows.Err()
+}
+
+func (repo *userRepository) SetLastSeen(id string, lastSeen time.Time) error {
+	stmt, err := repo.db.Prepare("UPDATE users SET last_seen = $2 WHERE id = $1")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(id, lastSeen)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *userRepository) ListUsers(prefix string, after string, limit int) ([]models.UserSummary, error) {
+	rows, err := repo.db.Query(`SELECT u.id, u.name, u.status, u.status_text, u.status_emoji, u.last_seen,
+		u.display_name, u.bio, u.timezone, u.avatar
+		FROM users u
+		WHERE (lower(u.name) LIKE $1 OR lower(u.username) LIKE $1)
+		AND ($2::text = '' OR (lower(u.name), u.id) > (SELECT lower(c.name), c.id FROM users c WHERE c.id = $2))
+		ORDER BY lower(u.name), u.id LIMIT $3`,
+		likePrefix(strings.ToLower(prefix)), after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.UserSummary
+	for rows.Next() {
+		var user UserSummary
+		if err := rows.Scan(&user.Id, &user.Name, &user.Status, &user.Text, &user.Emoji, &user.LastSeen,
+			&user.DisplayName, &user.Bio, &user.Timezone, &user.Avatar); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+func (repo *userRepository) CountUsers() (int, error) {
+	var count int
+	err := repo.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+
+	return count, err
+}
+
+func (repo *userRepository) FindProfile(id string) (models.Profile, error) {
+	row := repo.db.QueryRow("SELECT display_name, bio, timezone, avatar FROM users WHERE id = $1", id)
+
+	var profile Profile
+
+	if err := row.Scan(&profile.DisplayName, &profile.Bio, &profile.Timezone, &profile.Avatar); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (repo *userRepository) UpdateProfile(id string, displayName, bio, timezone string) error {
+	stmt, err := repo.db.Prepare("UPDATE users SET display_name = $2, bio = $3, timezone = $4 WHERE id = $1")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(id, displayName, bio, timezone)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repo *userRepository) SetAvatar(id string, avatar string) error {
+	stmt, err := repo.db.Prepare("UPDATE users SET avatar = $2 WHERE id = $1")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(id, avatar)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
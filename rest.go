@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nagohak/chat-app/api"
+	"github.com/nagohak/chat-app/models"
+)
+
+// How long a REST request waits for its message to go through the room
+const postTimeout = 5 * time.Second
+
+// CreateRoom stores a new room with the owner as its first member. The room starts
+// running the first time it is used.
+func (server *WsServer) CreateRoom(name string, private bool, owner models.User) (models.Room, error) {
+	if checkNewRoomName(name) != "" {
+		return nil, api.ErrInvalid
+	}
+
+	r := NewRoom(name, private, server)
+
+	if err := server.roomRepository.AddRoom(r); err != nil {
+		return nil, err
+	}
+
+	if err := server.roomRepository.AddRoomMember(r.GetId(), owner.GetID(), models.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// JoinRoom makes the user a member of the public room, so that REST clients can post to
+// it, and joins the user's clients on every node. Members can always join again.
+func (server *WsServer) JoinRoom(roomID string, user models.User) (models.Room, error) {
+	room := server.findRoomByID(roomID)
+	if room == nil {
+		return nil, api.ErrNotFound
+	}
+
+	banned, _, err := server.roomRepository.GetSanction(room.GetId(), user.GetID(), models.SanctionBan)
+	if err != nil {
+		return nil, err
+	}
+	if banned {
+		return nil, api.ErrForbidden
+	}
+
+	member, err := server.roomRepository.IsRoomMember(room.GetId(), user.GetID())
+	if err != nil {
+		return nil, err
+	}
+
+	if !member {
+		if room.Private || room.GetArchived() {
+			return nil, api.ErrForbidden
+		}
+
+		if err := server.roomRepository.AddRoomMember(room.GetId(), user.GetID(), models.RoleMember); err != nil {
+			return nil, err
+		}
+
+		room.publishRoomMessage(&Message{
+			Action:  MemberAddedAction,
+			Message: user.GetID(),
+			Target:  room,
+			Sender:  user,
+		})
+	}
+
+	server.joinUserClients(room, user)
+
+	return room, nil
+}
+
+// PostMessage sends a message through the room like a websocket client would and
+// returns it once it is stored and published.
+func (server *WsServer) PostMessage(roomID string, sender models.User, text string) (models.Message, error) {
+	message := &Message{
+		Action:  SendMessageAction,
+		Message: text,
+		Sender:  sender,
+		stored:  make(chan struct{}),
+	}
+
+	// An idle room may stop between the lookup and the post, the next lookup starts it again.
+	for posted := false; !posted; {
+		room := server.findRoomByID(roomID)
+		if room == nil {
+			return nil, api.ErrNotFound
+		}
+
+		if !server.can(room, sender.GetID(), PostPermission) || server.isMuted(room, sender.GetID()) {
+			return nil, api.ErrForbidden
+		}
+
+		message.Target = room
+
+		select {
+		case room.broadcast <- message:
+			posted = true
+		case <-room.stop:
+		case <-time.After(postTimeout):
+			return nil, errors.New("room is not responding")
+		}
+	}
+
+	select {
+	case <-message.stored:
+		if message.storeErr != nil {
+			return nil, message.storeErr
+		}
+		return message, nil
+	case <-time.After(postTimeout):
+		return nil, errors.New("room is not responding")
+	}
+}
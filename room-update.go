@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxRoomNameLength  = 255
+	maxRoomTopicLength = 255
+)
+
+// handleUpdateRoomMessage gives the room the name, topic and description of message.Target.
+// Owners and moderators may change the topic and description, only owners may rename.
+// An empty name keeps the current one.
+func (client *Client) handleUpdateRoomMessage(message Message) {
+	if message.Target == nil {
+		return
+	}
+
+	room := client.wsServer.findRoomByID(message.Target.GetId())
+	if room == nil || !client.isInRoom(room) {
+		return
+	}
+
+	name := strings.TrimSpace(message.Target.Name)
+	topic := strings.TrimSpace(message.Target.Topic)
+	description := strings.TrimSpace(message.Target.Description)
+
+	renamed := name != "" && name != room.GetName()
+	if !renamed {
+		name = room.GetName()
+	}
+	edited := topic != room.GetTopic() || description != room.GetDescription()
+	if !renamed && !edited {
+		return
+	}
+
+	if (renamed && !client.can(room, RenameRoomPermission)) || (edited && !client.can(room, EditRoomPermission)) {
+		client.sendError(room, "Not allowed to update this room")
+		return
+	}
+
+	if utf8.RuneCountInString(topic) > maxRoomTopicLength {
+		client.sendError(room, "Topic is too long")
+		return
+	}
+
+	repository := client.wsServer.roomRepository
+
+	if renamed {
+		if reason := client.wsServer.checkRoomName(room, name); reason != "" {
+			client.sendError(room, reason)
+			return
+		}
+
+		if err := repository.RenameRoom(room.GetId(), name, client.GetID()); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+
+	if edited {
+		if err := repository.UpdateRoom(room.GetId(), topic, description); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+
+	// Every node applies the update when the event arrives through the room channel.
+	room.publishRoomMessage(&Message{
+		Action: RoomUpdatedAction,
+		Target: &Room{
+			ID:          room.ID,
+			Name:        name,
+			Private:     room.Private,
+			Topic:       topic,
+			Description: description,
+		},
+		Sender: client,
+	})
+}
+
+// checkRoomName returns why the room cannot be renamed to name, or an empty string if it can.
+func (server *WsServer) checkRoomName(room *Room, name string) string {
+	if strings.HasPrefix(room.GetName(), directRoomPrefix) {
+		return "Direct conversations cannot be renamed"
+	}
+
+	if reason := checkNewRoomName(name); reason != "" {
+		return reason
+	}
+
+	existing, err := server.roomRepository.FindRoomByName(name)
+	if err != nil {
+		log.Println(err)
+		return "Could not rename the room"
+	}
+	if existing != nil && existing.GetId() != room.GetId() {
+		return "Room name is already taken"
+	}
+
+	return ""
+}
+
+// checkNewRoomName returns why a room cannot be named name, or an empty string if it can.
+// The direct and group prefixes are reserved for the rooms the server creates.
+func checkNewRoomName(name string) string {
+	if name == "" || utf8.RuneCountInString(name) > maxRoomNameLength {
+		return "Invalid room name"
+	}
+
+	if strings.HasPrefix(name, directRoomPrefix) || strings.HasPrefix(name, groupRoomPrefix) {
+		return "Invalid room name"
+	}
+
+	return ""
+}
+
+// applyUpdate runs on RunRoom, the lock keeps readers on other goroutines consistent.
+func (r *Room) applyUpdate(update *Room) {
+	if update == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.Name = update.Name
+	r.Topic = update.Topic
+	r.Description = update.Description
+}
@@ -2,58 +2,170 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/nagohak/chat-app/models"
 	"github.com/nagohak/chat-app/pkg/redis"
 )
 
 type Room struct {
-	ID         uuid.UUID `json:"id"`
-	Name       string    `json:"name"`
-	Private    bool      `json:"private"`
-	clients    map[*Client]bool
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan *Message
-	redis      *redis.Client
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Private     bool      `json:"private"`
+	Topic       string    `json:"topic,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Archived    bool      `json:"archived,omitempty"`
+	// lock guards the fields above that change while the room runs
+	lock              sync.RWMutex
+	clients           map[*Client]bool
+	register          chan *Client
+	unregister        chan *Client
+	broadcast         chan *Message
+	deliveries        chan []byte
+	removal           chan struct{}
+	stop              chan struct{}
+	stopOnce          sync.Once
+	lastActive        time.Time
+	wsServer          *WsServer
+	redis             *redis.Client
+	roomRepository    models.RoomRepository
+	messageRepository models.MessageRepository
 }
 
 const welcomeMessage = "%s joined the room"
 const leavedMessage = "%s leaved the room"
+const roomSeqKey = "room:%s:seq"
+
+// Rooms publish on a channel keyed by ID so renaming a room keeps its subscribers.
+const roomChannel = "room:%s"
 
 var ctx = context.Background()
 
-func NewRoom(name string, private bool, redis *redis.Client) *Room {
+func NewRoom(name string, private bool, wsServer *WsServer) *Room {
 	return &Room{
-		ID:         uuid.New(),
-		Name:       name,
-		Private:    private,
-		clients:    make(map[*Client]bool),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan *Message),
-		redis:      redis,
+		ID:                uuid.New(),
+		Name:              name,
+		Private:           private,
+		clients:           make(map[*Client]bool),
+		register:          make(chan *Client),
+		unregister:        make(chan *Client),
+		broadcast:         make(chan *Message),
+		deliveries:        make(chan []byte),
+		removal:           make(chan struct{}),
+		stop:              make(chan struct{}),
+		wsServer:          wsServer,
+		redis:             wsServer.redis,
+		roomRepository:    wsServer.roomRepository,
+		messageRepository: wsServer.messageRepository,
 	}
 }
 
 func (r *Room) RunRoom() {
+	r.initSeq()
 	go r.subscribeToRoomMessages()
 
+	// A room without local clients is stopped once it has been idle for roomIdleTimeout,
+	// i.e. after one to two periods. It is started again on the next lookup.
+	var idle <-chan time.Time
+	if timeout := r.wsServer.roomIdleTimeout; timeout > 0 {
+		ticker := time.NewTicker(timeout)
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+	r.lastActive = time.Now()
+
 	for {
 		select {
+		case <-idle:
+			if len(r.clients) == 0 && time.Since(r.lastActive) >= r.wsServer.roomIdleTimeout {
+				r.wsServer.stopRoom(r)
+				return
+			}
 		case client := <-r.register:
+			r.lastActive = time.Now()
 			r.registerClientInRoom(client)
 		case client := <-r.unregister:
+			r.lastActive = time.Now()
 			r.unregisterClientInRoom(client)
 		case message := <-r.broadcast:
-			r.publishRoomMessage(message.encode())
+			r.lastActive = time.Now()
+			err := r.handleMessage(message)
+			if message.stored != nil {
+				message.storeErr = err
+				close(message.stored)
+			}
+		case payload := <-r.deliveries:
+			r.deliverRoomMessage(payload)
+		case <-r.removal:
+			r.evictClients()
+			r.wsServer.stopRoom(r)
+			return
+		case <-r.stop:
+			return
 		}
 	}
 }
 
+// join, leave and post hand over to RunRoom. Once the room is stopped they do nothing,
+// join and post then report false.
+func (r *Room) join(client *Client) bool {
+	select {
+	case r.register <- client:
+		return true
+	case <-r.stop:
+		return false
+	}
+}
+
+func (r *Room) leave(client *Client) {
+	select {
+	case r.unregister <- client:
+	case <-r.stop:
+	}
+}
+
+func (r *Room) post(message *Message) bool {
+	select {
+	case r.broadcast <- message:
+		return true
+	case <-r.stop:
+		return false
+	}
+}
+
+// deliver hands a message to RunRoom to send it to the local clients of the room.
+func (r *Room) deliver(payload []byte) {
+	select {
+	case r.deliveries <- payload:
+	case <-r.stop:
+	}
+}
+
+// remove makes RunRoom tell its clients the room is deleted, evict them and stop.
+func (r *Room) remove() {
+	select {
+	case r.removal <- struct{}{}:
+	case <-r.stop:
+	}
+}
+
+// shutdown stops RunRoom and the Redis subscription of the room.
+func (r *Room) shutdown() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
 func (r *Room) registerClientInRoom(client *Client) {
+	if !r.allowsClient(client) {
+		return
+	}
+
 	// send welcome message first then new user won't see his own message
 	if !r.Private {
 		r.notifyClientJoinedRoom(client)
@@ -61,52 +173,206 @@ func (r *Room) registerClientInRoom(client *Client) {
 	r.clients[client] = true
 }
 
+// allowsClient reports whether the client may be in the room: banned users never,
+// public rooms are open to everyone else, private rooms only to their members.
+func (r *Room) allowsClient(client *Client) bool {
+	banned, _, err := r.roomRepository.GetSanction(r.GetId(), client.GetID(), models.SanctionBan)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	if banned {
+		return false
+	}
+
+	if !r.Private {
+		return true
+	}
+
+	member, err := r.roomRepository.IsRoomMember(r.GetId(), client.GetID())
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	return member
+}
+
 func (r *Room) unregisterClientInRoom(client *Client) {
+	if _, ok := r.clients[client]; !ok {
+		return
+	}
+
 	delete(r.clients, client)
 	r.notifyClientLeavedRoom(client)
 }
 
+// evictClients sends room-deleted to the clients and removes them. The room is gone, so
+// they drop it without announcing that they leave.
+func (r *Room) evictClients() {
+	event := &Message{
+		Action: RoomDeletedAction,
+		Target: r,
+	}
+	r.broadcastToClientsInRoom(event.encode())
+
+	for client := range r.clients {
+		delete(r.clients, client)
+		go client.evict(r)
+	}
+}
+
 func (r *Room) broadcastToClientsInRoom(message []byte) {
 	for client := range r.clients {
 		client.send <- message
 	}
 }
 
+// Join and leave notices are not stored, so they get no ID or sequence number that
+// would leave a gap in the room history.
 func (r *Room) notifyClientJoinedRoom(client *Client) {
 	message := &Message{
-		Action:  SendMessageAction,
-		Target:  r,
-		Message: fmt.Sprintf(welcomeMessage, client.GetName()),
+		Action:    SendMessageAction,
+		Target:    r,
+		Message:   fmt.Sprintf(welcomeMessage, client.GetName()),
+		CreatedAt: time.Now().UTC(),
 	}
 
-	r.publishRoomMessage(message.encode())
+	r.publishRoomMessage(message)
 }
 
 func (r *Room) notifyClientLeavedRoom(client *Client) {
 	message := &Message{
-		Action:  SendMessageAction,
-		Target:  r,
-		Message: fmt.Sprintf(leavedMessage, client.GetName()),
+		Action:    SendMessageAction,
+		Target:    r,
+		Message:   fmt.Sprintf(leavedMessage, client.GetName()),
+		CreatedAt: time.Now().UTC(),
 	}
 
-	r.publishRoomMessage(message.encode())
+	r.publishRoomMessage(message)
 }
 
-func (r *Room) publishRoomMessage(message []byte) {
-	err := r.redis.Publish(ctx, r.GetName(), message).Err()
+// initSeq makes sure the room sequence counter in Redis does not restart below
+// the messages already stored, e.g. after a Redis flush.
+func (r *Room) initSeq() {
+	seq, err := r.messageRepository.GetLastSeq(r.GetId())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := r.redis.SetNX(ctx, r.seqKey(), seq, 0).Err(); err != nil {
+		log.Println(err)
+	}
+}
+
+// lastSeq returns the sequence number of the latest message in the room.
+func (r *Room) lastSeq() (int64, error) {
+	seq, err := r.redis.Get(ctx, r.seqKey()).Int64()
+	if err == redis.Nil {
+		return r.messageRepository.GetLastSeq(r.GetId())
+	}
+
+	return seq, err
+}
+
+func (r *Room) seqKey() string {
+	return fmt.Sprintf(roomSeqKey, r.GetId())
+}
+
+// handleMessage stamps, stores and publishes a chat message. A message that cannot get a
+// sequence number is dropped, it would otherwise be stored with seq 0, and so is a message
+// that cannot be stored, it would be missing from the history.
+func (r *Room) handleMessage(message *Message) error {
+	if err := r.stampMessage(message); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if err := r.storeMessage(message); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	r.storeAttachments(message)
+	r.publishRoomMessage(message)
+
+	return nil
+}
+
+// stampMessage assigns the server side ID, timestamp and the next room sequence number.
+// The sequence is kept in Redis so it is monotonic across all nodes.
+func (r *Room) stampMessage(message *Message) error {
+	seq, err := r.redis.Incr(ctx, r.seqKey()).Result()
+	if err != nil {
+		return err
+	}
+
+	message.ID = uuid.New().String()
+	message.Target = r
+	message.CreatedAt = time.Now().UTC()
+	message.Seq = seq
+
+	return nil
+}
+
+func (r *Room) storeMessage(message *Message) error {
+	return r.messageRepository.AddMessage(message)
+}
+
+func (r *Room) publishRoomMessage(message *Message) {
+	err := r.redis.Publish(ctx, r.channel(), message.encode()).Err()
 
 	if err != nil {
 		log.Println(err)
 	}
 }
 
+func (r *Room) channel() string {
+	return fmt.Sprintf(roomChannel, r.GetId())
+}
+
 func (r *Room) subscribeToRoomMessages() {
-	pubsub := r.redis.Subscribe(ctx, r.GetName())
+	pubsub := r.redis.Subscribe(ctx, r.channel())
+	defer pubsub.Close()
 
 	ch := pubsub.Channel()
 
-	for msg := range ch {
-		r.broadcastToClientsInRoom([]byte(msg.Payload))
+	// Messages are delivered by RunRoom, which owns the clients of the room.
+	for {
+		select {
+		case msg := <-ch:
+			select {
+			case r.deliveries <- []byte(msg.Payload):
+			case <-r.stop:
+				return
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *Room) deliverRoomMessage(payload []byte) {
+	var message Message
+	if err := json.Unmarshal(payload, &message); err != nil {
+		log.Printf("Error on unmarshal JSON message %s\n", err)
+		return
+	}
+
+	switch {
+	case message.Action == TypingStartAction || message.Action == TypingStopAction:
+		r.broadcastToOthersInRoom(message.Sender.GetID(), payload)
+	case message.Action == MemberRemovedAction || message.Action == UserKickedAction || message.Action == UserBannedAction:
+		r.broadcastToClientsInRoom(payload)
+		r.evictUser(message.Message)
+	case message.Action == RoomUpdatedAction:
+		r.applyUpdate(message.Target)
+		r.broadcastToClientsInRoom(payload)
+	case message.ReplyTo != "":
+		r.broadcastToThreadParticipants(message.ReplyTo, payload)
+	default:
+		r.broadcastToClientsInRoom(payload)
 	}
 }
 
@@ -114,10 +380,56 @@ func (r *Room) GetId() string {
 	return r.ID.String()
 }
 
+// MarshalJSON encodes the room under its lock, as it can be updated while it is sent.
+func (r *Room) MarshalJSON() ([]byte, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return json.Marshal(struct {
+		ID          uuid.UUID `json:"id"`
+		Name        string    `json:"name"`
+		Private     bool      `json:"private"`
+		Topic       string    `json:"topic,omitempty"`
+		Description string    `json:"description,omitempty"`
+		Archived    bool      `json:"archived,omitempty"`
+	}{r.ID, r.Name, r.Private, r.Topic, r.Description, r.Archived})
+}
+
 func (r *Room) GetName() string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
 	return r.Name
 }
 
 func (r *Room) GetPrivate() bool {
 	return r.Private
 }
+
+func (r *Room) GetTopic() string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.Topic
+}
+
+func (r *Room) GetDescription() string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.Description
+}
+
+func (r *Room) GetArchived() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.Archived
+}
+
+func (r *Room) setArchived(archived bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.Archived = archived
+}
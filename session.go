@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nagohak/chat-app/pkg/redis"
+)
+
+const (
+	// How long a session stays stored while the client is connected
+	sessionTTL = 24 * time.Hour
+
+	// How long a disconnected client can resume its session
+	resumeWindow = 5 * time.Minute
+)
+
+const sessionKey = "session:%s"
+
+// Session is what a reconnecting client needs to get back its rooms.
+// It is stored in Redis so the client can resume on any node.
+type Session struct {
+	UserID string `json:"userId"`
+	// Rooms holds the IDs of the joined rooms
+	Rooms []string `json:"rooms"`
+}
+
+func (client *Client) sessionKey() string {
+	return fmt.Sprintf(sessionKey, client.resumeToken)
+}
+
+func (client *Client) saveSession() {
+	session := &Session{
+		UserID: client.GetID(),
+		Rooms:  make([]string, 0, len(client.rooms)),
+	}
+	for room := range client.rooms {
+		session.Rooms = append(session.Rooms, room.GetId())
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := client.wsServer.redis.Set(ctx, client.sessionKey(), data, sessionTTL).Err(); err != nil {
+		log.Println(err)
+	}
+}
+
+// expireSession keeps the session around for resumeWindow after a disconnect.
+func (client *Client) expireSession() {
+	if err := client.wsServer.redis.Expire(ctx, client.sessionKey(), resumeWindow).Err(); err != nil {
+		log.Println(err)
+	}
+}
+
+func (client *Client) notifySessionStarted() {
+	message := &Message{
+		Action:  SessionStartedAction,
+		Message: client.resumeToken,
+	}
+
+	client.send <- message.encode()
+}
+
+// handleResumeMessage restores the rooms of a previous session and replays every
+// message after the sequence number the client acknowledged for each room.
+func (client *Client) handleResumeMessage(message Message) {
+	key := fmt.Sprintf(sessionKey, message.Message)
+
+	data, err := client.wsServer.redis.Get(ctx, key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		log.Println(err)
+		return
+	}
+
+	if session.UserID != client.GetID() {
+		return
+	}
+
+	// A session can only be resumed once.
+	if err := client.wsServer.redis.Del(ctx, key).Err(); err != nil {
+		log.Println(err)
+	}
+
+	for _, roomID := range session.Rooms {
+		room := client.wsServer.findRoomByID(roomID)
+		if room == nil || !room.allowsClient(client) {
+			continue
+		}
+
+		// Member rooms are already joined on connect, together with their latest history.
+		joined := !client.isInRoom(room)
+		if joined {
+			if room = client.enterRoom(room); room == nil {
+				continue
+			}
+			client.rooms[room] = true
+			client.notifyRoomJoined(room, nil)
+		}
+
+		if ackSeq := message.Acks[room.GetId()]; ackSeq > 0 {
+			client.replayRoomMessages(room, ackSeq)
+		} else if joined {
+			client.sendRoomHistory(room, 0)
+		}
+	}
+
+	client.saveSession()
+}
+
+func (client *Client) replayRoomMessages(room *Room, afterSeq int64) {
+	for {
+		dbMessages, err := client.wsServer.messageRepository.GetRoomMessagesAfter(room.GetId(), afterSeq, historyPageSize)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		messages := make([]*Message, 0, len(dbMessages))
+		for _, dbMessage := range dbMessages {
+			messages = append(messages, newMessageFromModel(room, dbMessage))
+		}
+		client.wsServer.attachReactions(messages)
+		client.wsServer.attachAttachments(messages)
+
+		for _, message := range messages {
+			client.send <- message.encode()
+		}
+
+		if len(dbMessages) < historyPageSize {
+			return
+		}
+		afterSeq = dbMessages[len(dbMessages)-1].GetSeq()
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxStatusTextLength  = 100
+	maxStatusEmojiLength = 16
+)
+
+// handleSetStatusMessage stores the status the user picked and tells every node about it.
+func (client *Client) handleSetStatusMessage(message Message) {
+	status := message.Status
+	if status == "" {
+		status = PresenceOnline
+	}
+	if status != PresenceOnline && status != PresenceAway && status != PresenceDoNotDisturb {
+		client.sendError(nil, "Invalid status")
+		return
+	}
+
+	text := strings.TrimSpace(message.StatusText)
+	emoji := strings.TrimSpace(message.StatusEmoji)
+	if utf8.RuneCountInString(text) > maxStatusTextLength || utf8.RuneCountInString(emoji) > maxStatusEmojiLength {
+		client.sendError(nil, "Status is too long")
+		return
+	}
+
+	if err := client.wsServer.userRepository.SetUserStatus(client.GetID(), status, text, emoji); err != nil {
+		log.Println(err)
+		return
+	}
+
+	client.wsServer.publishPresence(client.wsServer.onlinePresence(client.GetID()))
+}
+
+// touch records activity of the client, at most a few times per away period.
+func (client *Client) touch() {
+	now := time.Now()
+	if now.Sub(client.activeAt) < client.wsServer.awayAfter/5 {
+		return
+	}
+
+	client.activeAt = now
+	client.wsServer.markActive(client.GetID())
+}
+
+// markActive keeps the user from being shown as away, bringing the user back if needed.
+func (server *WsServer) markActive(userID string) {
+	if server.awayAfter <= 0 {
+		return
+	}
+
+	if err := server.redis.Set(ctx, fmt.Sprintf(presenceActiveKey, userID), 1, server.awayAfter).Err(); err != nil {
+		log.Println(err)
+		return
+	}
+
+	removed, err := server.redis.SRem(ctx, presenceAwayKey, userID).Result()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if removed == 1 {
+		server.publishAwayChange(userID)
+	}
+}
+
+// publishAwayChange announces the user going away or coming back. Users that picked
+// away or do not disturb themselves look the same either way.
+func (server *WsServer) publishAwayChange(userID string) {
+	statuses, err := server.userRepository.GetUserStatuses([]string{userID})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if status := statuses[userID]; status != nil && status.GetStatus() != PresenceOnline {
+		return
+	}
+
+	server.publishPresence(server.onlinePresence(userID))
+}
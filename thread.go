@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log"
+	"strconv"
+)
+
+// prepareReply checks that the parent of a reply belongs to the room and points the
+// reply to the thread root, so threads are always one level deep. The author of the
+// root message and the replying user become participants of the thread.
+func (client *Client) prepareReply(room *Room, message *Message) bool {
+	repository := client.wsServer.messageRepository
+
+	parent, err := repository.FindMessageById(message.ReplyTo)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	if parent != nil && parent.GetReplyTo() != "" {
+		if parent, err = repository.FindMessageById(parent.GetReplyTo()); err != nil {
+			log.Println(err)
+			return false
+		}
+	}
+
+	if parent == nil || parent.GetRoomId() != room.GetId() {
+		return false
+	}
+
+	message.ReplyTo = parent.GetId()
+
+	for _, userID := range []string{parent.GetSender().GetID(), client.GetID()} {
+		if err := repository.AddThreadParticipant(message.ReplyTo, userID); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return true
+}
+
+// handleFetchThreadMessage sends the replies of a thread and subscribes the client to it.
+func (client *Client) handleFetchThreadMessage(message Message) {
+	room, parent := client.findThread(message)
+	if parent == "" {
+		return
+	}
+
+	repository := client.wsServer.messageRepository
+
+	if err := repository.AddThreadParticipant(parent, client.GetID()); err != nil {
+		log.Println(err)
+		return
+	}
+
+	// The cursor is the sequence number of the oldest reply the client already has.
+	var beforeSeq int64
+	if message.Message != "" {
+		var err error
+		if beforeSeq, err = strconv.ParseInt(message.Message, 10, 64); err != nil {
+			log.Printf("Invalid thread cursor: %s\n", err)
+			return
+		}
+	}
+
+	dbMessages, err := repository.GetThreadMessages(parent, beforeSeq, historyPageSize)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	thread := &Message{
+		ID:      parent,
+		Action:  FetchThreadAction,
+		Target:  room,
+		History: make([]*Message, 0, len(dbMessages)),
+	}
+
+	for _, dbMessage := range dbMessages {
+		thread.History = append(thread.History, newMessageFromModel(room, dbMessage))
+	}
+	client.wsServer.attachReactions(thread.History)
+	client.wsServer.attachAttachments(thread.History)
+
+	if len(dbMessages) == historyPageSize {
+		thread.Message = strconv.FormatInt(dbMessages[0].GetSeq(), 10)
+	}
+
+	client.send <- thread.encode()
+}
+
+func (client *Client) handleUnsubscribeThreadMessage(message Message) {
+	_, parent := client.findThread(message)
+	if parent == "" {
+		return
+	}
+
+	if err := client.wsServer.messageRepository.RemoveThreadParticipant(parent, client.GetID()); err != nil {
+		log.Println(err)
+	}
+}
+
+// findThread returns the room and the root message ID of the thread referenced by message.ID.
+func (client *Client) findThread(message Message) (*Room, string) {
+	if message.Target == nil || message.ID == "" {
+		return nil, ""
+	}
+
+	room := client.wsServer.findRoomByID(message.Target.GetId())
+	if room == nil || !client.isInRoom(room) {
+		return nil, ""
+	}
+
+	parent, err := client.wsServer.messageRepository.FindMessageById(message.ID)
+	if err != nil {
+		log.Println(err)
+		return nil, ""
+	}
+
+	if parent == nil || parent.GetRoomId() != room.GetId() || parent.GetReplyTo() != "" {
+		return nil, ""
+	}
+
+	return room, parent.GetId()
+}
+
+// broadcastToThreadParticipants delivers a reply only to the clients in the room
+// participating in the thread.
+func (r *Room) broadcastToThreadParticipants(parent string, message []byte) {
+	userIDs, err := r.messageRepository.GetThreadParticipants(parent)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	participants := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		participants[userID] = true
+	}
+
+	for client := range r.clients {
+		if participants[client.GetID()] {
+			client.send <- message
+		}
+	}
+}
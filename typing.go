@@ -0,0 +1,104 @@
+package main
+
+import "time"
+
+const (
+	// Typing indicator expires when the client stops refreshing it
+	typingTimeout = 6 * time.Second
+
+	// Minimum time between two typing events published for the same client and room
+	typingThrottle = 3 * time.Second
+)
+
+// typingState tracks the typing indicator of a client in a room. It is kept after a stop
+// so that alternating start and stop events stay throttled.
+type typingState struct {
+	// timer is armed while others see the client typing, it publishes typing-stop when it fires
+	timer    *time.Timer
+	lastSent time.Time
+}
+
+func (client *Client) handleTypingMessage(message Message) {
+	if message.Target == nil {
+		return
+	}
+
+	room := client.wsServer.findRoomByID(message.Target.GetId())
+	if room == nil || !client.isInRoom(room) {
+		return
+	}
+
+	if message.Action == TypingStartAction {
+		client.startTyping(room)
+	} else {
+		client.stopTyping(room)
+	}
+}
+
+// startTyping publishes typing-start, at most once per typingThrottle, and (re)arms the
+// timer that publishes typing-stop when the client stops sending updates.
+func (client *Client) startTyping(room *Room) {
+	now := time.Now()
+
+	state := client.typing[room]
+	if state == nil {
+		state = &typingState{}
+		client.typing[room] = state
+	}
+
+	if state.timer != nil && state.timer.Stop() {
+		state.timer.Reset(typingTimeout)
+		if now.Sub(state.lastSent) < typingThrottle {
+			return
+		}
+	} else {
+		// The client was just shown to stop typing.
+		if now.Sub(state.lastSent) < typingThrottle {
+			return
+		}
+		state.timer = time.AfterFunc(typingTimeout, func() {
+			room.publishTyping(client, TypingStopAction)
+		})
+	}
+
+	state.lastSent = now
+	room.publishTyping(client, TypingStartAction)
+}
+
+// stopTyping publishes typing-stop. Within typingThrottle of the last event the timer
+// publishes it once the throttle period is over, unless the client starts typing again.
+func (client *Client) stopTyping(room *Room) {
+	state := client.typing[room]
+
+	// If the timer already fired, typing-stop has been published.
+	if state == nil || state.timer == nil || !state.timer.Stop() {
+		return
+	}
+
+	if wait := typingThrottle - time.Since(state.lastSent); wait > 0 {
+		state.timer.Reset(wait)
+		return
+	}
+
+	state.lastSent = time.Now()
+	room.publishTyping(client, TypingStopAction)
+}
+
+// publishTyping sends typing events through the room channel without persisting them.
+func (r *Room) publishTyping(client *Client, action string) {
+	r.publishRoomMessage(&Message{
+		Action: action,
+		Target: r,
+		Sender: client,
+	})
+}
+
+// broadcastToOthersInRoom sends the message to every client in the room except the
+// clients of the given user.
+func (r *Room) broadcastToOthersInRoom(userID string, message []byte) {
+	for client := range r.clients {
+		if client.GetID() != userID {
+			client.send <- message
+		}
+	}
+}
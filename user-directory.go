@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/nagohak/chat-app/dto"
+	"github.com/nagohak/chat-app/models"
+)
+
+// UsersSummary is what new clients learn about the users instead of the full list.
+type UsersSummary struct {
+	Total  int `json:"total"`
+	Online int `json:"online"`
+}
+
+// shownUser is a directory entry with the status other users see.
+type shownUser struct {
+	models.UserSummary
+	status string
+}
+
+func (user *shownUser) GetStatus() string {
+	return user.status
+}
+
+// SearchUsers returns a page of users whose name or username starts with query, after
+// the user with the ID cursor. Users that are not connected have the offline status.
+func (server *WsServer) SearchUsers(query string, cursor string, limit int) ([]models.UserSummary, error) {
+	dbUsers, err := server.userRepository.ListUsers(query, cursor, limit)
+	if err != nil || len(dbUsers) == 0 {
+		return dbUsers, err
+	}
+
+	userIDs := make([]string, 0, len(dbUsers))
+	for _, dbUser := range dbUsers {
+		userIDs = append(userIDs, dbUser.GetID())
+	}
+
+	expiresAt, err := server.redis.ZMScore(ctx, presenceUsersKey, userIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]interface{}, 0, len(userIDs))
+	for _, userID := range userIDs {
+		members = append(members, userID)
+	}
+
+	away, err := server.redis.SMIsMember(ctx, presenceAwayKey, members...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := float64(time.Now().UnixMilli())
+
+	users := make([]models.UserSummary, 0, len(dbUsers))
+	for i, dbUser := range dbUsers {
+		status := PresenceOffline
+		if expiresAt[i] > now {
+			status = shownStatus(dbUser, away[i])
+		}
+		users = append(users, &shownUser{UserSummary: dbUser, status: status})
+	}
+
+	return users, nil
+}
+
+// handleSearchUsersMessage sends a page of users whose name starts with message.Message,
+// continuing after message.Cursor. The reply carries the cursor of the next page, if any.
+func (client *Client) handleSearchUsersMessage(message Message) {
+	users, err := client.wsServer.SearchUsers(message.Message, message.Cursor, directoryPageSize)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	reply := &Message{
+		Action:  SearchUsersAction,
+		Message: message.Message,
+		Users:   dto.NewUserListings(users),
+	}
+	if len(users) == directoryPageSize {
+		reply.Cursor = users[len(users)-1].GetID()
+	}
+
+	client.send <- reply.encode()
+}
+
+// sendUsersSummary tells the client how many users there are and how many are online.
+func (server *WsServer) sendUsersSummary(client *Client) {
+	total, err := server.userRepository.CountUsers()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	online, err := server.redis.ZCount(ctx, presenceUsersKey, "("+strconv.FormatInt(time.Now().UnixMilli(), 10), "+inf").Result()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	message := &Message{
+		Action:       UsersSummaryAction,
+		UsersSummary: &UsersSummary{Total: total, Online: int(online)},
+	}
+
+	client.send <- message.encode()
+}